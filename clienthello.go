@@ -3,6 +3,7 @@ package clienthellod
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -17,10 +18,12 @@ import (
 
 // ClientHello represents a captured ClientHello message with all fingerprintable fields.
 type ClientHello struct {
-	raw []byte
+	raw    []byte // all bytes read, i.e., every TLS record carrying the ClientHello
+	record []byte // single TLS record carrying the whole ClientHello, to be parsed
 
-	TLSRecordVersion    uint16 `json:"tls_record_version"`    // TLS record version (major, minor)
-	TLSHandshakeVersion uint16 `json:"tls_handshake_version"` // TLS handshake version (major, minor)
+	TLSRecordVersion    uint16   `json:"tls_record_version"`           // TLS record version (major, minor)
+	TLSHandshakeVersion uint16   `json:"tls_handshake_version"`        // TLS handshake version (major, minor)
+	TLSRecordLengths    []uint16 `json:"tls_record_lengths,omitempty"` // length of each TLS record the ClientHello is fragmented over
 
 	CipherSuites         []uint16       `json:"cipher_suites"`
 	CompressionMethods   utils.Uint8Arr `json:"compression_methods"`
@@ -39,6 +42,18 @@ type ClientHello struct {
 	KeyShare            []uint16       `json:"key_share"`              // key_share(51)
 	ApplicationSettings []string       `json:"application_settings"`   // application_settings(17513) a.k.a ALPS
 
+	SessionIDLength     int           `json:"session_id_length"`               // legacy_session_id
+	SessionTicketLength int           `json:"session_ticket_length,omitempty"` // session_ticket(35), zero when requesting a new ticket
+	PreSharedKey        *PreSharedKey `json:"pre_shared_key,omitempty"`        // pre_shared_key(41)
+	EarlyData           bool          `json:"early_data,omitempty"`            // early_data(42), the client intends to send 0-RTT data
+
+	KeyShareEntries []KeyShareEntry    `json:"key_share_entries"` // key_share(51) groups with their key share lengths
+	PostQuantum     PostQuantumSupport `json:"post_quantum"`      // derived from supported_groups(10) and key_share(51)
+
+	EncryptedClientHello *EncryptedClientHello `json:"encrypted_client_hello,omitempty"` // encrypted_client_hello(65037)
+
+	ExtensionRecords []ExtensionRecord `json:"extension_records"` // every extension as found on the wire, in original order
+
 	UserAgent string `json:"user_agent,omitempty"` // User-Agent header, set by the caller
 
 	NumID     int64  `json:"num_id,omitempty"`      // NID of the fingerprint
@@ -46,21 +61,69 @@ type ClientHello struct {
 	HexID     string `json:"hex_id,omitempty"`      // ID of the fingerprint (hex string)
 	NormHexID string `json:"norm_hex_id,omitempty"` // Normalized ID of the fingerprint (hex string)
 
+	// v2 fingerprint IDs additionally cover the ECH parameters, see calcNumericIDv2
+	NumIDv2     int64  `json:"num_id_v2,omitempty"`
+	NormNumIDv2 int64  `json:"norm_num_id_v2,omitempty"`
+	HexIDv2     string `json:"hex_id_v2,omitempty"`
+	NormHexIDv2 string `json:"norm_hex_id_v2,omitempty"`
+
+	JA3      string `json:"ja3,omitempty"`       // JA3 string, extensions in original order, GREASE removed
+	JA3Hash  string `json:"ja3_hash,omitempty"`  // MD5 hash of JA3 string (hex string)
+	JA3n     string `json:"ja3n,omitempty"`      // JA3n string, extensions sorted, GREASE removed
+	JA3nHash string `json:"ja3n_hash,omitempty"` // MD5 hash of JA3n string (hex string)
+
 	// below are ONLY used for calculating the fingerprint (hash)
 	lengthPrefixedSupportedGroups   []uint16
 	lengthPrefixedEcPointFormats    []uint8
 	lengthPrefixedSignatureAlgos    []uint16
 	alpnWithLengths                 []uint8
 	lengthPrefixedCertCompressAlgos []uint8
-	keyshareGroupsWithLengths       []uint16
 
 	// QUIC-only, nil if not QUIC
 	qtp *QUICTransportParameters
+
+	expiryToken uint64 // set when saved by TLSFingerprinter
+}
+
+// ExtensionRecord is an extension of a ClientHello as found on the wire,
+// including GREASE and unknown extensions.
+type ExtensionRecord struct {
+	ID     uint16 `json:"id"`               // extension type as on the wire, GREASE values are not replaced
+	Offset int    `json:"offset"`           // offset of the extension type from the start of the ClientHello handshake message
+	Length int    `json:"length"`           // length of Data
+	Data   []byte `json:"-"`                // extension data, see [ClientHello.ExtensionRecordsHex] to include it in JSON
+	GREASE bool   `json:"grease,omitempty"` // GREASE extension, RFC 8701
+}
+
+// ExtensionRecordHex is an ExtensionRecord with its data hex-encoded in
+// JSON, for debugging.
+type ExtensionRecordHex struct {
+	ExtensionRecord
+	Data string `json:"data"`
+}
+
+// ExtensionRecordsHex returns the ExtensionRecords with their data
+// hex-encoded in JSON.
+func (ch *ClientHello) ExtensionRecordsHex() []ExtensionRecordHex {
+	records := make([]ExtensionRecordHex, 0, len(ch.ExtensionRecords))
+	for _, er := range ch.ExtensionRecords {
+		records = append(records, ExtensionRecordHex{ExtensionRecord: er, Data: hex.EncodeToString(er.Data)})
+	}
+	return records
 }
 
+// ErrClientHelloTooLong is returned when a ClientHello exceeds
+// maxClientHelloLength, which no sane client needs.
+var ErrClientHelloTooLong = errors.New("ClientHello too long")
+
+const maxClientHelloLength = 0x10000 // 64KiB
+
 // ReadClientHello reads a ClientHello from a connection (io.Reader)
 // and returns a ClientHello struct.
 //
+// The ClientHello may be fragmented over several TLS records, in which case
+// all of them are read and their lengths are saved in TLSRecordLengths.
+//
 // It will return an error if the reader does not give a stream of bytes
 // representing a valid ClientHello. But all bytes read from the reader
 // will be stored in the ClientHello struct to be rewinded by the caller
@@ -69,22 +132,76 @@ type ClientHello struct {
 // This function does not automatically call [ClientHello.ParseClientHello].
 func ReadClientHello(r io.Reader) (ch *ClientHello, err error) {
 	ch = new(ClientHello)
-	// Read a TLS record
-	// Read exactly 5 bytes from the reader
-	ch.raw = make([]byte, 5)
-	if _, err = io.ReadFull(r, ch.raw); err != nil {
-		return
+	var handshake []byte // ClientHello handshake message, reassembled from the TLS records
+	for {
+		// Read a TLS record
+		// Read exactly 5 bytes from the reader
+		hdr := len(ch.raw)
+		ch.raw = append(ch.raw, make([]byte, 5)...)
+		var n int
+		n, err = io.ReadFull(r, ch.raw[hdr:])
+		ch.raw = ch.raw[:hdr+n]
+		if err != nil {
+			if errors.Is(err, io.EOF) && hdr > 0 {
+				err = io.ErrUnexpectedEOF // the ClientHello is incomplete
+			}
+			return
+		}
+
+		// Check if the first byte is 0x16 (TLS Handshake)
+		if ch.raw[hdr] != 0x16 {
+			err = errors.New("not a TLS handshake record")
+			return
+		}
+
+		recordLen := binary.BigEndian.Uint16(ch.raw[hdr+3 : hdr+5])
+		if recordLen == 0 {
+			err = errors.New("empty TLS handshake record")
+			return
+		}
+		if len(handshake)+int(recordLen) > maxClientHelloLength {
+			err = ErrClientHelloTooLong
+			return
+		}
+
+		// Read exactly length bytes from the reader
+		ch.raw = append(ch.raw, make([]byte, recordLen)...)
+		n, err = io.ReadFull(r, ch.raw[hdr+5:])
+		ch.raw = ch.raw[:hdr+5+n]
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+		handshake = append(handshake, ch.raw[hdr+5:]...)
+		ch.TLSRecordLengths = append(ch.TLSRecordLengths, recordLen)
+
+		// Stop once the whole handshake message is read
+		if len(handshake) >= 4 {
+			msgLen := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+			if 4+msgLen > maxClientHelloLength {
+				err = ErrClientHelloTooLong
+				return
+			}
+			if len(handshake) >= 4+msgLen {
+				break
+			}
+		}
 	}
 
-	// Check if the first byte is 0x16 (TLS Handshake)
-	if ch.raw[0] != 0x16 {
-		err = errors.New("not a TLS handshake record")
+	if len(ch.TLSRecordLengths) == 1 {
+		ch.record = ch.raw
 		return
 	}
 
-	// Read exactly length bytes from the reader
-	ch.raw = append(ch.raw, make([]byte, binary.BigEndian.Uint16(ch.raw[3:5]))...)
-	_, err = io.ReadFull(r, ch.raw[5:])
+	// Synthesize a single TLS record to be parsed. Its length may overflow
+	// but it is never used by the parser.
+	ch.record = make([]byte, 5, 5+len(handshake))
+	ch.record[0] = 0x16
+	copy(ch.record[1:3], ch.raw[1:3]) // TLS version of the first record
+	binary.BigEndian.PutUint16(ch.record[3:5], uint16(len(handshake)))
+	ch.record = append(ch.record, handshake...)
 	return
 }
 
@@ -104,17 +221,29 @@ func UnmarshalClientHello(p []byte) (ch *ClientHello, err error) {
 	return
 }
 
+// Raw returns all bytes read by [ReadClientHello], i.e., every TLS record
+// carrying the ClientHello as they were received.
 func (ch *ClientHello) Raw() []byte {
 	return ch.raw
 }
 
 // ParseClientHello parses the raw bytes of a ClientHello into a ClientHello struct.
+//
+// ClientHellos violating RFC 8446 without being malformed, e.g., with
+// duplicate extensions or pre_shared_key not last, are parsed too, so that
+// their senders can be fingerprinted. [ClientHello.Lint] reports such
+// violations.
 func (ch *ClientHello) ParseClientHello() error {
 	// Call uTLS to parse the raw bytes into ClientHelloSpec
 	fingerprinter := tls.Fingerprinter{
 		AllowBluntMimicry: true, // we will need all the extensions even when not recognized
 	}
-	chs, err := fingerprinter.RawClientHello(ch.raw)
+	chs, err := fingerprinter.RawClientHello(ch.record)
+	if masked := maskExtension(ch.record, extTypeEncryptedClientHello, extTypeMaskedEncryptedClientHello); err != nil && masked != nil {
+		// uTLS rejects malformed ECH extensions, which are parsed (or
+		// reported as malformed) by parseExtra instead
+		chs, err = fingerprinter.RawClientHello(masked)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to parse ClientHello, (*tls.Fingerprinter).RawClientHello(): %w", err)
 	}
@@ -127,13 +256,6 @@ func (ch *ClientHello) ParseClientHello() error {
 	// parse extensions
 	ch.parseExtensions(chs)
 
-	// Call uTLS to parse the raw bytes into ClientHelloMsg
-	chm := tls.UnmarshalClientHello(ch.raw[5:])
-	if chm == nil {
-		return errors.New("failed to parse ClientHello, (*tls.ClientHelloInfo).Unmarshal(): nil")
-	}
-	ch.ServerName = chm.ServerName
-
 	runtime.SetFinalizer(ch, func(c *ClientHello) {
 		c.qtp = nil // other trivial types are easy to GC
 	})
@@ -184,9 +306,7 @@ func (ch *ClientHello) parseExtensions(chs *tls.ClientHelloSpec) { // skipcq: GO
 		case *tls.KeyShareExtension:
 			for _, ks := range ext.KeyShares {
 				ch.KeyShare = append(ch.KeyShare, uint16(ks.Group))
-				// get below from raw instead
-				// ch.keyshareGroupsWithLengths = append(ch.keyshareGroupsWithLengths, uint16(ks.Group))
-				// ch.keyshareGroupsWithLengths = append(ch.keyshareGroupsWithLengths, uint16(len(ks.Data)))
+				// KeyShareEntries are parsed from raw instead
 			}
 		case *tls.ApplicationSettingsExtension:
 			ch.ApplicationSettings = ext.SupportedProtocols
@@ -201,7 +321,7 @@ func (ch *ClientHello) parseExtensions(chs *tls.ClientHelloSpec) { // skipcq: GO
 // parseExtra parses extra information from raw bytes which couldn't be parsed by uTLS.
 func (ch *ClientHello) parseExtra() error {
 	// parse alpnWithLengths and Extensions
-	s := cryptobyte.String(ch.raw)
+	s := cryptobyte.String(ch.record)
 	var recordVersion uint16
 	if !s.Skip(1) || !s.ReadUint16(&recordVersion) || !s.Skip(2) { // skip TLS record header
 		return errors.New("failed to parse TLS header, cryptobyte.String().Skip(): false")
@@ -216,10 +336,11 @@ func (ch *ClientHello) parseExtra() error {
 	}
 	ch.TLSHandshakeVersion = handshakeVersion
 
-	var ignoredSessionID cryptobyte.String
-	if !s.ReadUint8LengthPrefixed(&ignoredSessionID) {
+	var sessionID cryptobyte.String
+	if !s.ReadUint8LengthPrefixed(&sessionID) {
 		return errors.New("unable to read session id")
 	}
+	ch.SessionIDLength = len(sessionID)
 
 	var ignoredCipherSuites cryptobyte.String
 	if !s.ReadUint16LengthPrefixed(&ignoredCipherSuites) {
@@ -240,11 +361,14 @@ func (ch *ClientHello) parseExtra() error {
 		return errors.New("unable to read extensions data")
 	}
 
-	err := ch.parseExtensionsExtra(extensions)
+	extensionsOffset := len(ch.record) - 5 - len(s) - len(extensions) // from the start of the handshake message
+	err := ch.parseExtensionsExtra(extensions, extensionsOffset)
 	if err != nil {
 		return fmt.Errorf("failed to parse extensions, parseExtensionsExtra(): %w", err)
 	}
 
+	ch.PostQuantum = ch.classifyPostQuantum()
+
 	// sort ch.Extensions and put result to ch.ExtensionsNormalized
 	ch.ExtensionsNormalized = make([]uint16, len(ch.Extensions))
 	copy(ch.ExtensionsNormalized, ch.Extensions)
@@ -256,13 +380,23 @@ func (ch *ClientHello) parseExtra() error {
 	ch.NumID, ch.NormNumID = ch.calcNumericID()
 	ch.HexID = FingerprintID(ch.NumID).AsHex()
 	ch.NormHexID = FingerprintID(ch.NormNumID).AsHex()
+	ch.NumIDv2, ch.NormNumIDv2 = ch.calcNumericIDv2()
+	ch.HexIDv2 = FingerprintID(ch.NumIDv2).AsHex()
+	ch.NormHexIDv2 = FingerprintID(ch.NormNumIDv2).AsHex()
+
+	// calculate JA3 and JA3n
+	ch.JA3, ch.JA3n = ch.calcJA3()
+	ch.JA3Hash = ja3Hash(ch.JA3)
+	ch.JA3nHash = ja3Hash(ch.JA3n)
 
 	return nil
 }
 
-func (ch *ClientHello) parseExtensionsExtra(extensions cryptobyte.String) error {
+func (ch *ClientHello) parseExtensionsExtra(extensions cryptobyte.String, offset int) error {
 	var extensionIDs []uint16
+	extensionsLen := len(extensions)
 	for !extensions.Empty() {
+		extensionOffset := offset + extensionsLen - len(extensions)
 		var extensionID uint16
 		var extensionData cryptobyte.String
 		if !extensions.ReadUint16(&extensionID) {
@@ -271,6 +405,13 @@ func (ch *ClientHello) parseExtensionsExtra(extensions cryptobyte.String) error
 		if !extensions.ReadUint16LengthPrefixed(&extensionData) {
 			return errors.New("unable to read extension data")
 		}
+		ch.ExtensionRecords = append(ch.ExtensionRecords, ExtensionRecord{
+			ID:     extensionID,
+			Offset: extensionOffset,
+			Length: len(extensionData),
+			Data:   extensionData,
+			GREASE: utils.IsGREASEUint16(extensionID),
+		})
 
 		extensionID, err := ch.parseExtensionExtra(extensionID, extensionData)
 		if err != nil {
@@ -285,6 +426,21 @@ func (ch *ClientHello) parseExtensionsExtra(extensions cryptobyte.String) error
 
 func (ch *ClientHello) parseExtensionExtra(extensionID uint16, extensionData cryptobyte.String) (uint16, error) {
 	switch extensionID {
+	case 0: // server_name
+		var nameList cryptobyte.String
+		if !extensionData.ReadUint16LengthPrefixed(&nameList) {
+			return 0, errors.New("unable to read server name list")
+		}
+		for !nameList.Empty() {
+			var nameType uint8
+			var name cryptobyte.String
+			if !nameList.ReadUint8(&nameType) || !nameList.ReadUint16LengthPrefixed(&name) {
+				return 0, errors.New("unable to read server name")
+			}
+			if nameType == 0 && ch.ServerName == "" { // host_name
+				ch.ServerName = string(name)
+			}
+		}
 	case 16: // ALPN
 		ch.alpnWithLengths = extensionData
 	case 51: // keyshare
@@ -300,12 +456,28 @@ func (ch *ClientHello) parseExtensionExtra(extensionID uint16, extensionData cry
 			if utils.IsGREASEUint16(group) {
 				group = tls.GREASE_PLACEHOLDER
 			}
-			ch.keyshareGroupsWithLengths = append(ch.keyshareGroupsWithLengths, group, length)
+			ch.KeyShareEntries = append(ch.KeyShareEntries, newKeyShareEntry(group, length))
 
 			if !extensionData.Skip(int(length)) {
 				return 0, errors.New("unable to skip keyshare data")
 			}
 		}
+	case 35: // session_ticket
+		ch.SessionTicketLength = len(extensionData)
+	case 41: // pre_shared_key
+		psk, err := parsePreSharedKey(extensionData)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse pre_shared_key: %w", err)
+		}
+		ch.PreSharedKey = psk
+	case 42: // early_data
+		ch.EarlyData = true
+	case extTypeEncryptedClientHello:
+		ech, err := ParseEncryptedClientHello(extensionData)
+		if err != nil {
+			ech = &EncryptedClientHello{Malformed: true} // reported by Lint, the rest of the ClientHello is still fingerprinted
+		}
+		ch.EncryptedClientHello = ech
 	default:
 		if utils.IsGREASEUint16(extensionID) {
 			return tls.GREASE_PLACEHOLDER, nil
@@ -314,3 +486,33 @@ func (ch *ClientHello) parseExtensionExtra(extensionID uint16, extensionData cry
 
 	return extensionID, nil
 }
+
+// maskExtension returns a copy of the TLS record carrying a ClientHello with
+// the type of the first extension of type extType replaced by masked, or nil
+// if there is no such extension.
+func maskExtension(record []byte, extType, masked uint16) []byte {
+	s := cryptobyte.String(record)
+	var sessionID, cipherSuites, compressionMethods, extensions cryptobyte.String
+	if !s.Skip(5+4+2+32) || // TLS record header, handshake header, version and random
+		!s.ReadUint8LengthPrefixed(&sessionID) ||
+		!s.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!s.ReadUint8LengthPrefixed(&compressionMethods) ||
+		!s.ReadUint16LengthPrefixed(&extensions) {
+		return nil
+	}
+
+	for !extensions.Empty() {
+		offset := len(record) - len(s) - len(extensions)
+		var id uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&id) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil
+		}
+		if id == extType {
+			maskedRecord := bytes.Clone(record)
+			binary.BigEndian.PutUint16(maskedRecord[offset:], masked)
+			return maskedRecord
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	tls "github.com/refraction-networking/utls"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+var (
+	//go:embed internal/testdata/TLS_ClientHello_Firefox_126.bin
+	tlsClientHello_Firefox126 []byte
+)
+
+// utlsClientHello builds a ClientHello record with uTLS using the given
+// ClientHelloID, so tests can exercise GREASE and extension shuffling.
+func utlsClientHello(t *testing.T, id tls.ClientHelloID) []byte {
+	t.Helper()
+
+	uconn := tls.UClient(nil, &tls.Config{ServerName: "example.com"}, id) // skipcq: GSC-G402
+	if err := uconn.BuildHandshakeState(); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := uconn.HandshakeState.Hello.Raw
+	return append([]byte{0x16, 0x03, 0x01, byte(len(hs) >> 8), byte(len(hs))}, hs...)
+}
+
+// customClientHello builds a ClientHello record with uTLS from the given
+// spec, sending key shares with preset data as-is.
+func customClientHello(t *testing.T, spec *tls.ClientHelloSpec) []byte {
+	t.Helper()
+
+	uconn := tls.UClient(nil, &tls.Config{ServerName: "example.com"}, tls.HelloCustom) // skipcq: GSC-G402
+	if err := uconn.ApplyPreset(spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := uconn.BuildHandshakeState(); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := uconn.HandshakeState.Hello.Raw
+	return append([]byte{0x16, 0x03, 0x01, byte(len(hs) >> 8), byte(len(hs))}, hs...)
+}
+
+func mustUnmarshalClientHello(t *testing.T, p []byte) *ClientHello {
+	t.Helper()
+
+	ch, err := UnmarshalClientHello(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+// fragmentClientHello re-encodes a single-record ClientHello into TLS
+// records carrying the given number of handshake bytes, the last record
+// carrying the rest.
+func fragmentClientHello(record []byte, sizes ...int) []byte {
+	hs := record[5:]
+	var out []byte
+	for _, size := range append(sizes, len(hs)) {
+		if size > len(hs) {
+			size = len(hs)
+		}
+		out = append(out, 0x16, record[1], record[2], byte(size>>8), byte(size))
+		out = append(out, hs[:size]...)
+		hs = hs[size:]
+		if len(hs) == 0 {
+			break
+		}
+	}
+	return out
+}
+
+func TestReadClientHelloFragmented(t *testing.T) {
+	want := mustUnmarshalClientHello(t, tlsClientHello_Firefox126)
+	if len(want.TLSRecordLengths) != 1 || int(want.TLSRecordLengths[0]) != len(tlsClientHello_Firefox126)-5 {
+		t.Fatalf("TLSRecordLengths = %v, want a single record", want.TLSRecordLengths)
+	}
+
+	for name, tc := range map[string]struct {
+		sizes       []int
+		wantLengths []uint16
+	}{
+		"TwoRecords":      {[]int{300}, []uint16{300, 367}},
+		"TinyHeader":      {[]int{1, 2, 200}, []uint16{1, 2, 200, 464}},
+		"ManyRecords":     {[]int{100, 100, 100, 100, 100, 100}, []uint16{100, 100, 100, 100, 100, 100, 67}},
+		"TrailingMessage": {nil, []uint16{667}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			wire := fragmentClientHello(tlsClientHello_Firefox126, tc.sizes...)
+			extra := []byte{0x14, 0x03, 0x03, 0x00, 0x01, 0x01} // ChangeCipherSpec, must not be read
+
+			ch, err := ReadClientHello(bytes.NewReader(append(append([]byte{}, wire...), extra...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(ch.Raw(), wire) {
+				t.Error("Raw() does not match the bytes on the wire")
+			}
+			if !reflect.DeepEqual(ch.TLSRecordLengths, tc.wantLengths) {
+				t.Errorf("TLSRecordLengths = %v, want %v", ch.TLSRecordLengths, tc.wantLengths)
+			}
+
+			if err = ch.ParseClientHello(); err != nil {
+				t.Fatal(err)
+			}
+			if ch.HexID != want.HexID || ch.NormHexID != want.NormHexID || ch.JA4() != want.JA4() {
+				t.Errorf("got IDs %s/%s/%s, want %s/%s/%s", ch.HexID, ch.NormHexID, ch.JA4(), want.HexID, want.NormHexID, want.JA4())
+			}
+			if ch.TLSRecordVersion != want.TLSRecordVersion || ch.ServerName != want.ServerName {
+				t.Errorf("got record version %#04x and SNI %q, want %#04x and %q", ch.TLSRecordVersion, ch.ServerName, want.TLSRecordVersion, want.ServerName)
+			}
+		})
+	}
+}
+
+func TestReadClientHelloFragmentedTruncated(t *testing.T) {
+	wire := fragmentClientHello(tlsClientHello_Firefox126, 300)
+
+	for _, n := range []int{305, 306, 310, len(wire) - 1} {
+		if _, err := ReadClientHello(bytes.NewReader(wire[:n])); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("truncated at %d: got %v, want io.ErrUnexpectedEOF", n, err)
+		}
+	}
+
+	// a non-handshake record in the middle of the ClientHello
+	bad := append([]byte{}, wire...)
+	bad[305] = 0x17
+	if _, err := ReadClientHello(bytes.NewReader(bad)); err == nil {
+		t.Error("expected error for an application data record within the ClientHello")
+	}
+}
+
+func TestClientHelloExtensionRecords(t *testing.T) {
+	for name, record := range map[string][]byte{
+		"Firefox126":   tlsClientHello_Firefox126,
+		"Chrome120":    utlsClientHello(t, tls.HelloChrome_120),
+		"Fragmented":   fragmentClientHello(tlsClientHello_Firefox126, 100, 200),
+		"Chrome120_PQ": utlsClientHello(t, tls.HelloChrome_120_PQ),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ch := mustUnmarshalClientHello(t, record)
+			if len(ch.ExtensionRecords) != len(ch.Extensions) {
+				t.Fatalf("got %d ExtensionRecords, want %d", len(ch.ExtensionRecords), len(ch.Extensions))
+			}
+
+			var handshake []byte // ClientHello handshake message, without TLS record headers
+			for raw := ch.Raw(); len(raw) > 0; {
+				n := 5 + (int(raw[3])<<8 | int(raw[4]))
+				handshake, raw = append(handshake, raw[5:n]...), raw[n:]
+			}
+
+			var grease int
+			for i, er := range ch.ExtensionRecords {
+				if got := uint16(handshake[er.Offset])<<8 | uint16(handshake[er.Offset+1]); got != er.ID {
+					t.Errorf("record %d: ID %#04x at offset %d, want %#04x", i, got, er.Offset, er.ID)
+				}
+				if !bytes.Equal(handshake[er.Offset+4:er.Offset+4+er.Length], er.Data) || len(er.Data) != er.Length {
+					t.Errorf("record %d: data does not match the handshake message", i)
+				}
+				if er.GREASE {
+					grease++
+					if ch.Extensions[i] != tls.GREASE_PLACEHOLDER {
+						t.Errorf("record %d: GREASE record for extension %#04x", i, ch.Extensions[i])
+					}
+				} else if er.ID != ch.Extensions[i] {
+					t.Errorf("record %d: ID %#04x, want %#04x", i, er.ID, ch.Extensions[i])
+				}
+			}
+			if strings.HasPrefix(name, "Chrome") && grease != 2 {
+				t.Errorf("got %d GREASE records, want 2", grease)
+			}
+
+			hexRecords := ch.ExtensionRecordsHex()
+			if len(hexRecords) != len(ch.ExtensionRecords) || hexRecords[0].Data != hex.EncodeToString(ch.ExtensionRecords[0].Data) {
+				t.Errorf("ExtensionRecordsHex() = %+v", hexRecords)
+			}
+		})
+	}
+}
+
+// TestParseClientHelloNonConforming checks ClientHellos violating RFC 8446
+// are still parsed, for Lint to report the violations, while malformed ones
+// are rejected.
+func TestParseClientHelloNonConforming(t *testing.T) {
+	x25519 := &tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519, Data: make([]byte, 32)}}}
+	psk := &tls.GenericExtension{Id: 41, Data: []byte{0, 7, 0, 1, 0xff, 0, 0, 0, 1, 0, 33, 32}}
+	psk.Data = append(psk.Data, make([]byte, 32)...)
+
+	for name, exts := range map[string][]tls.TLSExtension{
+		"DuplicateExtension":  {x25519, &tls.GenericExtension{Id: 0x1a1b}, &tls.GenericExtension{Id: 0x1a1b}},
+		"PreSharedKeyNotLast": {x25519, psk, &tls.GenericExtension{Id: 0x1a1b}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ch, err := UnmarshalClientHello(lintClientHello(t, nil, exts...))
+			if err != nil {
+				t.Fatalf("non-conforming ClientHello rejected: %v", err)
+			}
+			if ch.HexID == "" || ch.JA4() == "" || ch.Lint() == nil {
+				t.Error("non-conforming ClientHello not fingerprinted or not linted")
+			}
+		})
+	}
+
+	t.Run("TruncatedExtension", func(t *testing.T) {
+		raw := lintClientHello(t, nil, x25519)
+		raw[len(raw)-32-2] = 0xff // key share length beyond the extension
+		if _, err := UnmarshalClientHello(raw); err == nil {
+			t.Error("malformed ClientHello accepted")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// diffRecord is a field that differs between the two fingerprints. A or B is
+// absent if the field is missing on that side.
+type diffRecord struct {
+	Path string `json:"path"`
+	A    any    `json:"a,omitempty"`
+	B    any    `json:"b,omitempty"`
+}
+
+func runDiff(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("diff", "a b", stderr)
+	ignore := fs.String("ignore", "", "comma-separated list of field paths to ignore, e.g., server_name,user_agent")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected 2 inputs, got %d", fs.NArg())
+	}
+	if fs.Arg(0) == "-" && fs.Arg(1) == "-" {
+		return errors.New("stdin can only be one of the inputs")
+	}
+
+	a, err := loadFingerprint(fs.Arg(0), stdin)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	b, err := loadFingerprint(fs.Arg(1), stdin)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(1), err)
+	}
+
+	ignored := make(map[string]bool)
+	for _, path := range strings.Split(*ignore, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			ignored[path] = true
+		}
+	}
+
+	diffs := diffFingerprints(a, b, ignored)
+	out := newJSONLinesWriter(stdout)
+	for _, d := range diffs {
+		if err = out.Write(d); err != nil {
+			return err
+		}
+	}
+
+	if len(diffs) > 0 {
+		return errDiffer
+	}
+	return nil
+}
+
+// loadFingerprint loads a fingerprint either from a JSON object, such as a
+// line printed by the parse or pcap subcommands, or from a raw ClientHello
+// record or QUIC Initial packet (binary or hex).
+//
+// If the object wraps a fingerprint (quic_fingerprint, client_hello or
+// client_initial), only the wrapped fingerprint is returned.
+func loadFingerprint(src string, stdin io.Reader) (map[string]any, error) {
+	data, err := readInput(src, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		recs, err := parseMessage(src, data, "auto")
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(recs[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	var obj map[string]any
+	if err = json.NewDecoder(bytes.NewReader(data)).Decode(&obj); err != nil { // first JSON object only
+		return nil, err
+	}
+
+	for _, key := range []string{"quic_fingerprint", "client_hello", "client_initial"} {
+		if inner, ok := obj[key].(map[string]any); ok {
+			return inner, nil
+		}
+	}
+	return obj, nil
+}
+
+// diffFingerprints compares two JSON objects field by field, recursing into
+// nested objects. Arrays are compared as a whole, since the order of their
+// elements is part of the fingerprint.
+func diffFingerprints(a, b map[string]any, ignored map[string]bool) []*diffRecord {
+	var diffs []*diffRecord
+	diffObjects("", a, b, ignored, &diffs)
+	return diffs
+}
+
+func diffObjects(prefix string, a, b map[string]any, ignored map[string]bool, diffs *[]*diffRecord) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if ignored[path] {
+			continue
+		}
+
+		va, vb := a[k], b[k]
+		objA, okA := va.(map[string]any)
+		objB, okB := vb.(map[string]any)
+		if okA && okB {
+			diffObjects(path, objA, objB, ignored, diffs)
+			continue
+		}
+
+		if !reflect.DeepEqual(va, vb) {
+			*diffs = append(*diffs, &diffRecord{Path: path, A: va, B: vb})
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Command clienthellod fingerprints TLS ClientHello messages and QUIC Initial
+// packets from raw messages, packet captures or live connections.
+//
+// All subcommands write JSON Lines to stdout, one JSON object per line, to be
+// consumed by tools like jq.
+//
+// Usage:
+//
+//	clienthellod parse [-type auto|tls|quic] [file ...]
+//	clienthellod pcap [-tls=true] [-quic=true] file ...
+//	clienthellod diff a b
+//	clienthellod serve [-addr :8443] [-cert cert.pem -key key.pem]
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+var commands = []command{
+	{"parse", "parse raw ClientHello messages or QUIC Initial packets (binary or hex)", runParse},
+	{"pcap", "fingerprint every TLS and QUIC handshake in pcap/pcapng captures", runPcap},
+	{"diff", "compare two fingerprints field by field", runDiff},
+	{"serve", "serve HTTPS, echoing the fingerprint of each client", runServe},
+}
+
+// errDiffer is returned by diff when the fingerprints differ, to exit with
+// status 1 like diff(1) without printing an error.
+var errDiffer = errors.New("fingerprints differ")
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		err := cmd.run(args, os.Stdin, os.Stdout, os.Stderr)
+		if errors.Is(err, errDiffer) {
+			os.Exit(1)
+		}
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clienthellod %s: %v\n", name, err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "clienthellod: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: clienthellod <command> [flags] [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-6s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'clienthellod <command> -h' for the flags of a command.\n")
+}
+
+// newFlagSet creates a FlagSet for a subcommand, reporting errors instead of
+// exiting so that subcommands can be tested.
+func newFlagSet(name, args string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("clienthellod "+name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: clienthellod %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// jsonLinesWriter writes each value as a single line of JSON.
+type jsonLinesWriter struct {
+	enc *json.Encoder
+}
+
+func newJSONLinesWriter(w io.Writer) *jsonLinesWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonLinesWriter{enc: enc}
+}
+
+func (w *jsonLinesWriter) Write(v any) error {
+	return w.enc.Encode(v) // Encode terminates each value with a newline
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/refraction-networking/clienthellod"
+)
+
+const testdataDir = "../../internal/testdata"
+
+// jsonLines decodes each line of out as a JSON object.
+func jsonLines(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var objs []map[string]any
+	sc := bufio.NewScanner(out)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var obj map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &obj); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", sc.Text(), err)
+		}
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+func TestParseTLSHex(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join(testdataDir, "TLS_ClientHello_Firefox_126.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err = runParse(nil, strings.NewReader(hex.EncodeToString(raw)+"\n"), &out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	recs := jsonLines(t, &out)
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	if recs[0]["type"] != "tls" {
+		t.Errorf("type = %v, want tls", recs[0]["type"])
+	}
+	ch, _ := recs[0]["client_hello"].(map[string]any)
+	if ch["ja3_hash"] != "b5001237acdf006056b409cc433726b0" {
+		t.Errorf("client_hello.ja3_hash = %v", ch["ja3_hash"])
+	}
+}
+
+func TestParseQUIC(t *testing.T) {
+	var out bytes.Buffer
+	err := runParse([]string{
+		"-type", "quic",
+		filepath.Join(testdataDir, "QUIC_IETF_Chrome_125_PKN1.bin"),
+		filepath.Join(testdataDir, "QUIC_IETF_Chrome_125_PKN2.bin"),
+	}, nil, &out, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs := jsonLines(t, &out)
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3", len(recs))
+	}
+	for i, want := range []string{"quic_initial", "quic_initial", "quic"} {
+		if recs[i]["type"] != want {
+			t.Errorf("record %d: type = %v, want %s", i, recs[i]["type"], want)
+		}
+	}
+	qfp, _ := recs[2]["quic_fingerprint"].(map[string]any)
+	if qfp["ja4"] != "q13d0311h3_55b375c5d22e_5a1f323ef56d" {
+		t.Errorf("quic_fingerprint.ja4 = %v", qfp["ja4"])
+	}
+}
+
+func TestParseQUICIncomplete(t *testing.T) {
+	var out, errOut bytes.Buffer
+	err := runParse([]string{
+		filepath.Join(testdataDir, "QUIC_IETF_Chrome_125_PKN1.bin"),
+	}, nil, &out, &errOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recs := jsonLines(t, &out); len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	if !strings.Contains(errOut.String(), "QUIC ClientHello is incomplete") {
+		t.Errorf("stderr = %q, want a warning about the incomplete ClientHello", errOut.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	firefox := filepath.Join(testdataDir, "TLS_ClientHello_Firefox_126.bin")
+
+	// a parsed record of the same ClientHello with a different server_name
+	other := filepath.Join(t.TempDir(), "other.json")
+	var parsed bytes.Buffer
+	if err := runParse([]string{firefox}, nil, &parsed, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	otherJSON := strings.Replace(parsed.String(), `"server_name":"`, `"server_name":"other.`, 1)
+	if err := os.WriteFile(other, []byte(otherJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runDiff([]string{firefox, firefox}, nil, &out, io.Discard); err != nil {
+		t.Fatalf("identical inputs: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("identical inputs: unexpected output %s", out.String())
+	}
+
+	out.Reset()
+	if err := runDiff([]string{firefox, other}, nil, &out, io.Discard); !errors.Is(err, errDiffer) {
+		t.Fatalf("different inputs: got %v, want errDiffer", err)
+	}
+	diffs := jsonLines(t, &out)
+	if len(diffs) == 0 {
+		t.Fatal("different inputs: no diff")
+	}
+	var paths []string
+	for _, d := range diffs {
+		paths = append(paths, d["path"].(string))
+	}
+
+	out.Reset()
+	if err := runDiff([]string{"-ignore", strings.Join(paths, ","), firefox, other}, nil, &out, io.Discard); err != nil {
+		t.Errorf("all differences ignored: %v", err)
+	}
+
+	out.Reset()
+	if err := runDiff([]string{"-", "-"}, strings.NewReader("{}"), &out, io.Discard); err == nil || !strings.Contains(err.Error(), "stdin") {
+		t.Errorf("stdin as both inputs: got %v, want an error rejecting the arguments", err)
+	}
+}
+
+func TestFingerprintListenerSlowClient(t *testing.T) {
+	ch, err := os.ReadFile(filepath.Join(testdataDir, "TLS_ClientHello_Firefox_126.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tfp := clienthellod.NewTLSFingerprinter()
+	defer tfp.Close()
+	var out bytes.Buffer
+	fl := &fingerprintListener{Listener: l, tfp: tfp, out: newJSONLinesWriter(&out)}
+	defer fl.Close()
+
+	silent, err := net.Dial("tcp", l.Addr().String()) // never sends its ClientHello
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err = client.Write(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := fl.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	var conn net.Conn
+	for i := 0; i < 2; i++ {
+		select {
+		case c := <-accepted:
+			defer c.Close()
+			if c.RemoteAddr().String() == client.LocalAddr().String() {
+				conn = c
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Accept blocked by a client not sending its ClientHello")
+		}
+	}
+
+	rewound := make([]byte, len(ch))
+	if _, err = io.ReadFull(conn, rewound); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rewound, ch) {
+		t.Error("ClientHello is not rewound")
+	}
+	if records := jsonLines(t, &out); len(records) != 1 || records[0]["remote_addr"] != client.LocalAddr().String() {
+		t.Errorf("records = %v, want the ClientHello of %s", records, client.LocalAddr())
+	}
+}
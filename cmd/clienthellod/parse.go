@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/refraction-networking/clienthellod"
+)
+
+// parseRecord is the output of the parse subcommand. Exactly one of
+// ClientHello, ClientInitial and QUICFingerprint is set.
+type parseRecord struct {
+	Source string `json:"source"`
+	Type   string `json:"type"` // "tls", "quic_initial" or "quic"
+
+	ClientHello     *clienthellod.ClientHello     `json:"client_hello,omitempty"`
+	ClientInitial   *clienthellod.ClientInitial   `json:"client_initial,omitempty"`
+	QUICFingerprint *clienthellod.QUICFingerprint `json:"quic_fingerprint,omitempty"`
+}
+
+func runParse(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("parse", "[file ...]", stderr)
+	msgType := fs.String("type", "auto", "message type: auto, tls or quic")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *msgType != "auto" && *msgType != "tls" && *msgType != "quic" {
+		return fmt.Errorf("invalid -type %q", *msgType)
+	}
+
+	sources := fs.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	out := newJSONLinesWriter(stdout)
+
+	// QUIC Initial packets of all inputs are gathered together, as a
+	// ClientHello may span multiple packets.
+	var gci *clienthellod.GatheredClientInitials
+	for _, src := range sources {
+		data, err := readInput(src, stdin)
+		if err != nil {
+			return err
+		}
+
+		recs, err := parseMessage(src, data, *msgType)
+		if err != nil {
+			return fmt.Errorf("%s: %w", src, err)
+		}
+		for _, rec := range recs {
+			if err = out.Write(rec); err != nil {
+				return err
+			}
+
+			if rec.ClientInitial != nil {
+				if gci == nil {
+					gci = clienthellod.GatherClientInitialsWithDeadline(time.Now().Add(time.Minute))
+				}
+				if err = gci.AddPacket(rec.ClientInitial); err != nil {
+					return fmt.Errorf("%s: %w", src, err)
+				}
+			}
+		}
+	}
+
+	if gci == nil {
+		return nil
+	}
+	if !gci.Completed() {
+		fmt.Fprintln(stderr, "clienthellod parse: QUIC ClientHello is incomplete, more Initial packets are needed")
+		return nil
+	}
+
+	qfp, err := clienthellod.GenerateQUICFingerprint(gci)
+	if err != nil {
+		return err
+	}
+	return out.Write(&parseRecord{
+		Source:          strings.Join(sources, ","),
+		Type:            "quic",
+		QUICFingerprint: qfp,
+	})
+}
+
+// parseMessage parses a TLS ClientHello record, or every QUIC Initial packet
+// coalesced in a UDP datagram.
+func parseMessage(src string, data []byte, msgType string) ([]*parseRecord, error) {
+	if msgType == "auto" {
+		switch {
+		case len(data) == 0:
+			return nil, errors.New("empty input")
+		case data[0] == 0x16: // TLS handshake record
+			msgType = "tls"
+		case data[0]&0x80 != 0: // QUIC long header
+			msgType = "quic"
+		default:
+			return nil, errors.New("neither a TLS handshake record nor a QUIC long header packet")
+		}
+	}
+
+	if msgType == "tls" {
+		ch, err := clienthellod.UnmarshalClientHello(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*parseRecord{{Source: src, Type: "tls", ClientHello: ch}}, nil
+	}
+
+	packets, err := clienthellod.UnmarshalQUICDatagram(data)
+	if err != nil {
+		return nil, err
+	}
+	var recs []*parseRecord
+	for _, cp := range packets {
+		if cp.Initial != nil {
+			recs = append(recs, &parseRecord{Source: src, Type: "quic_initial", ClientInitial: cp.Initial})
+		}
+	}
+	if len(recs) == 0 {
+		return nil, errors.New("no QUIC Initial packet")
+	}
+	return recs, nil
+}
+
+// readInput reads a file, or stdin if src is "-". Inputs made only of hex
+// digits and whitespace are hex-decoded.
+func readInput(src string, stdin io.Reader) ([]byte, error) {
+	var data []byte
+	var err error
+	if src == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return maybeDecodeHex(data), nil
+}
+
+// maybeDecodeHex returns the hex-decoded data if data is a hex string
+// (whitespace allowed), otherwise data as-is.
+func maybeDecodeHex(data []byte) []byte {
+	compact := bytes.Join(bytes.Fields(data), nil)
+	if len(compact) == 0 || len(compact)%2 != 0 {
+		return data
+	}
+
+	decoded := make([]byte, hex.DecodedLen(len(compact)))
+	if _, err := hex.Decode(decoded, compact); err != nil {
+		return data
+	}
+	return decoded
+}
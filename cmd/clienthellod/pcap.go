@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/refraction-networking/clienthellod/pcap"
+)
+
+// pcapRecord is the output of the pcap subcommand.
+type pcapRecord struct {
+	File string `json:"file"`
+	*pcap.Result
+}
+
+func runPcap(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("pcap", "file ...", stderr)
+	withTLS := fs.Bool("tls", true, "output TLS ClientHellos over TCP")
+	withQUIC := fs.Bool("quic", true, "output QUIC fingerprints")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no capture file given")
+	}
+
+	out := newJSONLinesWriter(stdout)
+	for _, path := range fs.Args() {
+		if err := fingerprintCapture(path, *withTLS, *withQUIC, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fingerprintCapture(path string, withTLS, withQUIC bool, out *jsonLinesWriter) error {
+	r, err := pcap.Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for {
+		res, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if (res.ClientHello != nil && !withTLS) || (res.QUICFingerprint != nil && !withQUIC) {
+			continue
+		}
+		if err = out.Write(&pcapRecord{File: path, Result: res}); err != nil {
+			return err
+		}
+	}
+}
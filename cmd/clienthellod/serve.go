@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/clienthellod"
+)
+
+// serveRecord is printed by the serve subcommand for each client.
+type serveRecord struct {
+	Timestamp   time.Time                 `json:"timestamp"`
+	RemoteAddr  string                    `json:"remote_addr"`
+	ClientHello *clienthellod.ClientHello `json:"client_hello"`
+}
+
+func runServe(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("serve", "", stderr)
+	addr := fs.String("addr", ":8443", "TCP address to listen on")
+	certFile := fs.String("cert", "", "TLS certificate file (PEM), a self-signed certificate is generated if empty")
+	keyFile := fs.String("key", "", "TLS private key file (PEM)")
+	ttl := fs.Duration("ttl", clienthellod.DEFAULT_TLSFINGERPRINT_EXPIRY, "how long each fingerprint is kept for the HTTP request to look it up")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var cert tls.Certificate
+	var err error
+	if *certFile != "" || *keyFile != "" {
+		cert, err = tls.LoadX509KeyPair(*certFile, *keyFile)
+	} else {
+		cert, err = selfSignedCertificate()
+	}
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+
+	tfp := clienthellod.NewTLSFingerprinterWithTimeout(*ttl)
+	defer tfp.Close()
+
+	fl := &fingerprintListener{
+		Listener: l,
+		tfp:      tfp,
+		out:      newJSONLinesWriter(stdout),
+	}
+
+	fmt.Fprintf(stderr, "clienthellod serve: listening on %s\n", l.Addr())
+
+	srv := &http.Server{
+		Handler:           echoHandler(tfp),
+		TLSConfig:         &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.ServeTLS(fl, "", "")
+}
+
+// echoHandler writes the ClientHello of the requesting client as JSON.
+func echoHandler(tfp *clienthellod.TLSFingerprinter) http.Handler {
+	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		ch := tfp.Peek(req.RemoteAddr)
+		if ch == nil {
+			http.Error(wr, "ClientHello not found", http.StatusNotFound)
+			return
+		}
+		ch.UserAgent = req.UserAgent()
+
+		var b []byte
+		var err error
+		if req.URL.Query().Get("beautify") == "true" {
+			b, err = json.MarshalIndent(ch, "", "  ")
+		} else {
+			b, err = json.Marshal(ch)
+		}
+		if err != nil {
+			http.Error(wr, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		wr.Header().Set("Content-Type", "application/json")
+		if req.ProtoMajor == 1 {
+			wr.Header().Set("Connection", "close")
+		}
+		_, _ = wr.Write(b)
+	})
+}
+
+// fingerprintListener fingerprints the ClientHello of each accepted
+// connection before handing it to the TLS server.
+type fingerprintListener struct {
+	net.Listener
+	tfp *clienthellod.TLSFingerprinter
+
+	outMutex sync.Mutex
+	out      *jsonLinesWriter
+}
+
+// Accept returns the accepted connection right away. Its ClientHello is read
+// on the first Read, i.e., from the goroutine serving the connection, so a
+// client slow to send its ClientHello does not hold up the others. The TLS
+// handshake timeout of the server bounds how long it may take.
+func (l *fingerprintListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &fingerprintConn{Conn: conn, l: l}, nil
+}
+
+// fingerprintConn reads the ClientHello of a connection on the first Read
+// and rewinds it for the TLS server.
+type fingerprintConn struct {
+	net.Conn
+	l *fingerprintListener
+
+	once       sync.Once
+	rewindConn net.Conn
+	err        error
+}
+
+func (c *fingerprintConn) Read(b []byte) (int, error) {
+	c.once.Do(c.fingerprint)
+	if c.err != nil {
+		return 0, c.err // not TLS, malformed or timed out, the TLS server drops the connection
+	}
+	return c.rewindConn.Read(b)
+}
+
+func (c *fingerprintConn) fingerprint() {
+	c.rewindConn, c.err = c.l.tfp.HandleTCPConn(c.Conn)
+	if c.err != nil {
+		return
+	}
+
+	c.l.outMutex.Lock()
+	_ = c.l.out.Write(&serveRecord{
+		Timestamp:   time.Now().UTC(),
+		RemoteAddr:  c.RemoteAddr().String(),
+		ClientHello: c.l.tfp.Peek(c.RemoteAddr().String()),
+	})
+	c.l.outMutex.Unlock()
+}
+
+// selfSignedCertificate generates an ephemeral self-signed certificate.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "clienthellod"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -142,7 +142,7 @@ func fingerprintCorpusPcap(t *testing.T, path string) map[string]fingerprintHash
 		}
 		cip, err := UnmarshalQUICClientInitialPacket(udp.Payload)
 		if err != nil {
-			continue // not a decryptable QUIC v1 client Initial (e.g. GREASE version)
+			continue // not a decryptable QUIC v1/v2 client Initial (e.g. GREASE version)
 		}
 		dcid := corpusDCID(udp.Payload)
 		if dcid == nil {
@@ -0,0 +1,123 @@
+package clienthellod
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// extTypeEncryptedClientHello is the extension ID of encrypted_client_hello,
+// not yet in dicttls.
+const extTypeEncryptedClientHello uint16 = 0xfe0d
+
+// extTypeMaskedEncryptedClientHello replaces the extension ID of a malformed
+// encrypted_client_hello extension for uTLS not to parse it. It was used by
+// a draft of ECH and is unknown to uTLS.
+const extTypeMaskedEncryptedClientHello uint16 = 0xfe0c
+
+const (
+	ECHClientHelloType_outer uint8 = 0
+	ECHClientHelloType_inner uint8 = 1
+)
+
+// HPKE algorithm identifiers used by ECH, see RFC 9180.
+const (
+	HPKE_KDF_HKDF_SHA256 uint16 = 0x0001
+	HPKE_KDF_HKDF_SHA384 uint16 = 0x0002
+	HPKE_KDF_HKDF_SHA512 uint16 = 0x0003
+
+	HPKE_AEAD_AES_128_GCM      uint16 = 0x0001
+	HPKE_AEAD_AES_256_GCM      uint16 = 0x0002
+	HPKE_AEAD_ChaCha20Poly1305 uint16 = 0x0003
+	HPKE_AEAD_ExportOnly       uint16 = 0xffff
+)
+
+// hpkeX25519EncapsulatedKeyLen is the length of the encapsulated key of
+// DHKEM(X25519, HKDF-SHA256).
+const hpkeX25519EncapsulatedKeyLen = 32
+
+// echGREASEPayloadLengths are the ECH payload lengths sent by known GREASE
+// ECH implementations: BoringSSL (Chrome) picks one of 128, 160, 192 or 224
+// bytes plus the 16-byte AEAD tag, NSS (Firefox) sends a fixed 239 bytes.
+var echGREASEPayloadLengths = map[uint16]bool{
+	144: true,
+	176: true,
+	208: true,
+	240: true,
+	239: true,
+}
+
+// EncryptedClientHello is the encrypted_client_hello(65037) extension of a
+// ClientHello, see draft-ietf-tls-esni.
+//
+// Only the outer ClientHello is visible to a passive observer, therefore the
+// encapsulated key and the payload are not kept, only their lengths.
+type EncryptedClientHello struct {
+	Type uint8 `json:"type"` // ECHClientHelloType_outer or ECHClientHelloType_inner
+
+	// below are only set for an outer ClientHello
+	KDFID         uint16 `json:"kdf_id,omitempty"`
+	AEADID        uint16 `json:"aead_id,omitempty"`
+	ConfigID      uint8  `json:"config_id,omitempty"`
+	EncLength     uint16 `json:"enc_length,omitempty"`     // length of the encapsulated key
+	PayloadLength uint16 `json:"payload_length,omitempty"` // length of the encrypted inner ClientHello
+
+	// GREASE tells if the extension is likely GREASE ECH (RFC 8701 style
+	// dummy sent without any ECHConfig) rather than real ECH. The two are
+	// designed to look alike, so this is a heuristic: the extension is
+	// considered GREASE if it matches the cipher suite, key length and
+	// payload lengths used by known GREASE ECH implementations.
+	GREASE bool `json:"grease"`
+
+	// Malformed tells if the extension could not be parsed, e.g., an
+	// experimental or broken ECH implementation. No other field is set then.
+	Malformed bool `json:"malformed,omitempty"`
+}
+
+// ParseEncryptedClientHello parses the data of an encrypted_client_hello
+// extension.
+func ParseEncryptedClientHello(extensionData []byte) (*EncryptedClientHello, error) {
+	s := cryptobyte.String(extensionData)
+
+	ech := &EncryptedClientHello{}
+	if !s.ReadUint8(&ech.Type) {
+		return nil, errors.New("unable to read ECH type")
+	}
+
+	switch ech.Type {
+	case ECHClientHelloType_inner:
+		if !s.Empty() {
+			return nil, errors.New("inner ECH extension is not empty")
+		}
+		return ech, nil
+	case ECHClientHelloType_outer:
+	default:
+		return nil, errors.New("unknown ECH type")
+	}
+
+	var enc, payload cryptobyte.String
+	if !s.ReadUint16(&ech.KDFID) || !s.ReadUint16(&ech.AEADID) {
+		return nil, errors.New("unable to read ECH cipher suite")
+	}
+	if !s.ReadUint8(&ech.ConfigID) {
+		return nil, errors.New("unable to read ECH config ID")
+	}
+	if !s.ReadUint16LengthPrefixed(&enc) {
+		return nil, errors.New("unable to read ECH encapsulated key")
+	}
+	if !s.ReadUint16LengthPrefixed(&payload) || len(payload) == 0 {
+		return nil, errors.New("unable to read ECH payload")
+	}
+	if !s.Empty() {
+		return nil, errors.New("trailing data after ECH payload")
+	}
+	ech.EncLength = uint16(len(enc))
+	ech.PayloadLength = uint16(len(payload))
+
+	ech.GREASE = ech.KDFID == HPKE_KDF_HKDF_SHA256 &&
+		(ech.AEADID == HPKE_AEAD_AES_128_GCM || ech.AEADID == HPKE_AEAD_ChaCha20Poly1305) &&
+		ech.EncLength == hpkeX25519EncapsulatedKeyLen &&
+		echGREASEPayloadLengths[ech.PayloadLength]
+
+	return ech, nil
+}
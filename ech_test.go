@@ -0,0 +1,123 @@
+package clienthellod_test
+
+import (
+	"testing"
+
+	tls "github.com/refraction-networking/utls"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+// echOuter builds the data of an outer encrypted_client_hello extension.
+func echOuter(kdf, aead uint16, configID uint8, encLen, payloadLen int) []byte {
+	b := []byte{ECHClientHelloType_outer, byte(kdf >> 8), byte(kdf), byte(aead >> 8), byte(aead), configID}
+	b = append(b, byte(encLen>>8), byte(encLen))
+	b = append(b, make([]byte, encLen)...)
+	b = append(b, byte(payloadLen>>8), byte(payloadLen))
+	return append(b, make([]byte, payloadLen)...)
+}
+
+func TestParseEncryptedClientHello(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data    []byte
+		want    EncryptedClientHello
+		wantErr bool
+	}{
+		"BoringSSLGREASE": {
+			data: echOuter(HPKE_KDF_HKDF_SHA256, HPKE_AEAD_AES_128_GCM, 0x42, 32, 176),
+			want: EncryptedClientHello{KDFID: 1, AEADID: 1, ConfigID: 0x42, EncLength: 32, PayloadLength: 176, GREASE: true},
+		},
+		"Real": {
+			data: echOuter(HPKE_KDF_HKDF_SHA256, HPKE_AEAD_AES_128_GCM, 0x42, 32, 400),
+			want: EncryptedClientHello{KDFID: 1, AEADID: 1, ConfigID: 0x42, EncLength: 32, PayloadLength: 400},
+		},
+		"RealOtherCipherSuite": {
+			data: echOuter(HPKE_KDF_HKDF_SHA384, HPKE_AEAD_AES_256_GCM, 7, 97, 176),
+			want: EncryptedClientHello{KDFID: 2, AEADID: 2, ConfigID: 7, EncLength: 97, PayloadLength: 176},
+		},
+		"Inner": {
+			data: []byte{ECHClientHelloType_inner},
+			want: EncryptedClientHello{Type: ECHClientHelloType_inner},
+		},
+		"Empty":          {data: nil, wantErr: true},
+		"UnknownType":    {data: []byte{2}, wantErr: true},
+		"InnerNotEmpty":  {data: []byte{ECHClientHelloType_inner, 0}, wantErr: true},
+		"Truncated":      {data: echOuter(1, 1, 0, 32, 176)[:100], wantErr: true},
+		"EmptyPayload":   {data: echOuter(1, 1, 0, 32, 0), wantErr: true},
+		"TrailingData":   {data: append(echOuter(1, 1, 0, 32, 176), 0), wantErr: true},
+		"MissingEncSize": {data: []byte{ECHClientHelloType_outer, 0, 1, 0, 1, 0}, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ech, err := ParseEncryptedClientHello(tc.data)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", ech)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *ech != tc.want {
+				t.Errorf("got %+v, want %+v", *ech, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientHelloEncryptedClientHello(t *testing.T) {
+	ch := mustUnmarshalClientHello(t, tlsClientHello_Firefox126)
+
+	want := EncryptedClientHello{
+		KDFID:         HPKE_KDF_HKDF_SHA256,
+		AEADID:        HPKE_AEAD_ChaCha20Poly1305,
+		ConfigID:      77,
+		EncLength:     32,
+		PayloadLength: 239,
+		GREASE:        true, // Firefox without any ECHConfig
+	}
+	if ch.EncryptedClientHello == nil || *ch.EncryptedClientHello != want {
+		t.Errorf("EncryptedClientHello = %+v, want %+v", ch.EncryptedClientHello, want)
+	}
+
+	// v1 IDs must not change with ECH awareness
+	if ch.HexID != "30913c00670fb923" || ch.NormHexID != "822abe02c86e2353" {
+		t.Errorf("v1 IDs = %s/%s", ch.HexID, ch.NormHexID)
+	}
+	if ch.HexIDv2 == ch.HexID || ch.NormHexIDv2 == ch.NormHexID || ch.HexIDv2 == ch.NormHexIDv2 {
+		t.Errorf("v2 IDs %s/%s must differ from v1 IDs and from each other", ch.HexIDv2, ch.NormHexIDv2)
+	}
+
+	// BoringSSL GREASE ECH, as sent by Chrome without any ECHConfig
+	chrome := mustUnmarshalClientHello(t, utlsClientHello(t, tls.HelloChrome_120))
+	if chrome.EncryptedClientHello == nil || !chrome.EncryptedClientHello.GREASE {
+		t.Errorf("Chrome EncryptedClientHello = %+v, want GREASE", chrome.EncryptedClientHello)
+	}
+
+	// no ECH at all
+	old := mustUnmarshalClientHello(t, utlsClientHello(t, tls.HelloChrome_100))
+	if old.EncryptedClientHello != nil {
+		t.Errorf("EncryptedClientHello = %+v, want nil", old.EncryptedClientHello)
+	}
+	if old.HexIDv2 == old.HexID {
+		t.Error("v2 ID must differ from v1 ID without ECH")
+	}
+}
+
+func TestClientHelloEncryptedClientHelloMalformed(t *testing.T) {
+	raw := lintClientHello(t, nil,
+		&tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519, Data: make([]byte, 32)}}},
+		&tls.GenericExtension{Id: 0xfe0d, Data: []byte{0x07}}, // unknown ECH type
+	)
+
+	ch, err := UnmarshalClientHello(raw)
+	if err != nil {
+		t.Fatalf("a malformed ECH extension must not fail the ClientHello: %v", err)
+	}
+	if ch.EncryptedClientHello == nil || !ch.EncryptedClientHello.Malformed {
+		t.Errorf("EncryptedClientHello = %+v, want malformed", ch.EncryptedClientHello)
+	}
+	if ch.HexID == "" || ch.HexIDv2 == "" || ch.JA3 == "" || ch.JA4() == "" {
+		t.Error("fingerprints of a ClientHello with a malformed ECH extension are missing")
+	}
+}
@@ -0,0 +1,130 @@
+package clienthellod
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/refraction-networking/utls/dicttls"
+)
+
+// ExtensionOrderClass classifies how a client orders its extensions across
+// connections.
+type ExtensionOrderClass string
+
+const (
+	// ExtensionOrderFixed is set when every observation has the extensions
+	// in the same order, so NumID is stable for the client.
+	ExtensionOrderFixed ExtensionOrderClass = "fixed-order"
+
+	// ExtensionOrderRandomized is set when the observations are permutations
+	// of each other which keep GREASE, padding and pre_shared_key in place,
+	// as Chrome does since version 110.
+	ExtensionOrderRandomized ExtensionOrderClass = "randomized"
+
+	// ExtensionOrderAnomalous is set when the observations cannot come from
+	// one client with either a fixed or a randomized order, e.g., they do not
+	// have the same extensions or GREASE moves around.
+	ExtensionOrderAnomalous ExtensionOrderClass = "anomalous"
+
+	// ExtensionOrderUnknown is set when there is no observation to classify.
+	ExtensionOrderUnknown ExtensionOrderClass = "unknown"
+)
+
+// ExtensionOrder is the result of [ClassifyExtensionOrder].
+type ExtensionOrder struct {
+	Class          ExtensionOrderClass `json:"order_class"`
+	Observations   int                 `json:"observations"`
+	DistinctOrders int                 `json:"distinct_orders"`
+	Reason         string              `json:"reason,omitempty"` // why the order is anomalous
+}
+
+// ClassifyExtensionOrder tells if ClientHellos observed from one client are
+// consistent with a fixed or a randomized extension order.
+//
+// A randomizing client keeps GREASE extensions at the same positions and
+// padding and pre_shared_key last, and shuffles the rest. Padding and
+// pre_shared_key may come and go between observations, depending on the
+// ClientHello length and on session resumption.
+//
+// A single observation is always reported as fixed-order, since a
+// randomized order cannot be told apart from it. No observation at all is
+// reported as unknown.
+func ClassifyExtensionOrder(observations []*ClientHello) ExtensionOrder {
+	if len(observations) == 0 {
+		return ExtensionOrder{Class: ExtensionOrderUnknown}
+	}
+
+	result := ExtensionOrder{
+		Class:        ExtensionOrderFixed,
+		Observations: len(observations),
+	}
+
+	var (
+		firstShuffled []uint16
+		firstPinned   []int
+		orders        [][]uint16
+	)
+	for i, ch := range observations {
+		shuffled, pinned, err := splitExtensionOrder(ch)
+		if err != nil {
+			result.Class = ExtensionOrderAnomalous
+			result.Reason = fmt.Sprintf("observation %d: %v", i, err)
+			return result
+		}
+
+		if i == 0 {
+			firstShuffled, firstPinned = sortedCopy(shuffled), pinned
+		} else if !slices.Equal(pinned, firstPinned) {
+			result.Class = ExtensionOrderAnomalous
+			result.Reason = fmt.Sprintf("observation %d: GREASE extensions at positions %v, want %v", i, pinned, firstPinned)
+			return result
+		} else if !slices.Equal(sortedCopy(shuffled), firstShuffled) {
+			result.Class = ExtensionOrderAnomalous
+			result.Reason = fmt.Sprintf("observation %d: different set of extensions", i)
+			return result
+		}
+
+		if !slices.ContainsFunc(orders, func(order []uint16) bool { return slices.Equal(order, shuffled) }) {
+			orders = append(orders, shuffled)
+		}
+	}
+
+	result.DistinctOrders = len(orders)
+	if result.DistinctOrders > 1 {
+		result.Class = ExtensionOrderRandomized
+	}
+	return result
+}
+
+// splitExtensionOrder splits the extensions of a ClientHello into the ones a
+// randomizing client shuffles, in the observed order, and the positions of
+// the GREASE extensions. Trailing padding and pre_shared_key are dropped.
+func splitExtensionOrder(ch *ClientHello) (shuffled []uint16, pinned []int, err error) {
+	records := ch.ExtensionRecords
+	if n := len(records); n > 0 && records[n-1].ID == dicttls.ExtType_pre_shared_key {
+		records = records[:n-1]
+	}
+	if n := len(records); n > 0 && records[n-1].ID == dicttls.ExtType_padding {
+		records = records[:n-1]
+	}
+
+	for i, er := range records {
+		switch {
+		case er.GREASE:
+			pinned = append(pinned, i)
+		case er.ID == dicttls.ExtType_pre_shared_key:
+			return nil, nil, fmt.Errorf("pre_shared_key at position %d is not last", i)
+		case er.ID == dicttls.ExtType_padding:
+			return nil, nil, fmt.Errorf("padding at position %d is not last", i)
+		default:
+			shuffled = append(shuffled, er.ID)
+		}
+	}
+	return shuffled, pinned, nil
+}
+
+func sortedCopy(s []uint16) []uint16 {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
@@ -0,0 +1,121 @@
+package clienthellod_test
+
+import (
+	"testing"
+
+	tls "github.com/refraction-networking/utls"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+// orderedClientHello builds a ClientHello with the given extensions in order.
+func orderedClientHello(t *testing.T, exts ...tls.TLSExtension) *ClientHello {
+	t.Helper()
+
+	return mustUnmarshalClientHello(t, customClientHello(t, &tls.ClientHelloSpec{
+		CipherSuites:       []uint16{tls.TLS_AES_128_GCM_SHA256},
+		CompressionMethods: []byte{0},
+		Extensions:         exts,
+	}))
+}
+
+func TestClassifyExtensionOrder(t *testing.T) {
+	var (
+		grease   = func() tls.TLSExtension { return &tls.UtlsGREASEExtension{} }
+		sni      = func() tls.TLSExtension { return &tls.SNIExtension{} }
+		groups   = func() tls.TLSExtension { return &tls.SupportedCurvesExtension{Curves: []tls.CurveID{tls.X25519}} }
+		versions = func() tls.TLSExtension { return &tls.SupportedVersionsExtension{Versions: []uint16{tls.VersionTLS13}} }
+		alpn     = func() tls.TLSExtension { return &tls.ALPNExtension{AlpnProtocols: []string{"h2"}} }
+		padding  = func() tls.TLSExtension { return &tls.GenericExtension{Id: 21, Data: make([]byte, 8)} }
+	)
+
+	for name, tc := range map[string]struct {
+		observations [][]tls.TLSExtension
+		want         ExtensionOrderClass
+		distinct     int
+	}{
+		"None": {
+			want: ExtensionOrderUnknown,
+		},
+		"Single": {
+			observations: [][]tls.TLSExtension{{grease(), sni(), groups(), versions(), grease()}},
+			want:         ExtensionOrderFixed,
+			distinct:     1,
+		},
+		"Fixed": {
+			observations: [][]tls.TLSExtension{
+				{sni(), groups(), versions(), alpn()},
+				{sni(), groups(), versions(), alpn()},
+			},
+			want:     ExtensionOrderFixed,
+			distinct: 1,
+		},
+		"Randomized": {
+			observations: [][]tls.TLSExtension{
+				{grease(), sni(), groups(), versions(), alpn(), grease()},
+				{grease(), alpn(), versions(), sni(), groups(), grease(), padding()},
+				{grease(), groups(), sni(), alpn(), versions(), grease()},
+			},
+			want:     ExtensionOrderRandomized,
+			distinct: 3,
+		},
+		"GREASEMoved": {
+			observations: [][]tls.TLSExtension{
+				{grease(), sni(), groups(), versions(), alpn()},
+				{sni(), grease(), groups(), versions(), alpn()},
+			},
+			want: ExtensionOrderAnomalous,
+		},
+		"DifferentExtensions": {
+			observations: [][]tls.TLSExtension{
+				{sni(), groups(), versions(), alpn()},
+				{sni(), groups(), versions()},
+			},
+			want: ExtensionOrderAnomalous,
+		},
+		"PaddingNotLast": {
+			observations: [][]tls.TLSExtension{
+				{sni(), groups(), versions(), alpn()},
+				{sni(), groups(), padding(), versions(), alpn()},
+			},
+			want: ExtensionOrderAnomalous,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var observations []*ClientHello
+			for _, exts := range tc.observations {
+				observations = append(observations, orderedClientHello(t, exts...))
+			}
+
+			got := ClassifyExtensionOrder(observations)
+			if got.Class != tc.want || got.Observations != len(observations) {
+				t.Fatalf("ClassifyExtensionOrder() = %+v, want class %q", got, tc.want)
+			}
+			if tc.want == ExtensionOrderAnomalous {
+				if got.Reason == "" {
+					t.Errorf("ClassifyExtensionOrder() = %+v, want a reason", got)
+				}
+			} else if got.DistinctOrders != tc.distinct {
+				t.Errorf("ClassifyExtensionOrder() = %+v, want %d distinct orders", got, tc.distinct)
+			}
+		})
+	}
+}
+
+func TestClassifyExtensionOrderParrots(t *testing.T) {
+	var chrome, firefox []*ClientHello
+	for i := 0; i < 8; i++ {
+		chrome = append(chrome, mustUnmarshalClientHello(t, utlsClientHello(t, tls.HelloChrome_120)))
+		firefox = append(firefox, mustUnmarshalClientHello(t, tlsClientHello_Firefox126))
+	}
+
+	if got := ClassifyExtensionOrder(chrome); got.Class != ExtensionOrderRandomized {
+		t.Errorf("Chrome 120: ClassifyExtensionOrder() = %+v", got)
+	}
+	if got := ClassifyExtensionOrder(firefox); got.Class != ExtensionOrderFixed {
+		t.Errorf("Firefox 126: ClassifyExtensionOrder() = %+v", got)
+	}
+	if got := ClassifyExtensionOrder(append(chrome[:1], firefox[0])); got.Class != ExtensionOrderAnomalous {
+		t.Errorf("Chrome 120 and Firefox 126: ClassifyExtensionOrder() = %+v", got)
+	}
+}
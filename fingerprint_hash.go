@@ -90,86 +90,130 @@ func (ch *ClientHello) calcNumericID() (orig, norm int64) {
 	for _, normalized := range []bool{false, true} {
 		h := sha1.New() // skipcq: GO-S1025, GSC-G401
 
-		// TLS handshake version as u32 (record version excluded)
-		binary.Write(h, binary.BigEndian, uint32(ch.TLSHandshakeVersion))
+		ch.writeFingerprintInputs(h, normalized)
 
-		// Cipher suites — ungreased, flat big-endian u16 bytes
-		for _, cs := range ch.CipherSuites {
-			binary.Write(h, binary.BigEndian, ungreaseU16(cs))
+		if normalized {
+			norm = int64(binary.BigEndian.Uint64(h.Sum(nil)[:8]))
+		} else {
+			orig = int64(binary.BigEndian.Uint64(h.Sum(nil)[:8]))
 		}
+	}
+	return
+}
 
-		// Compression methods — flat bytes
-		h.Write(ch.CompressionMethods)
+// calcNumericIDv2 computes both the original and normalized v2 TLS
+// fingerprint IDs, which are not part of retina_quic_fp.
+//
+// Same SHA-1 inputs as calcNumericID, followed by the ECH parameters:
+//   - ech_present(u8), 2 if malformed, then if present and not malformed:
+//     type(u8), kdf_id(u16), aead_id(u16), enc_length(u16), grease(u8)
+//   - The config ID and payload length are excluded, being chosen by the
+//     server or randomized per connection.
+func (ch *ClientHello) calcNumericIDv2() (orig, norm int64) {
+	for _, normalized := range []bool{false, true} {
+		h := sha1.New() // skipcq: GO-S1025, GSC-G401
 
-		// Extensions — ungreased (already handled by clienthellod), sorted if normalized
-		exts := ch.Extensions
-		if normalized {
-			exts = ch.ExtensionsNormalized
-		}
-		for _, ext := range exts {
-			binary.Write(h, binary.BigEndian, ungreaseU16(ext))
+		ch.writeFingerprintInputs(h, normalized)
+
+		if ech := ch.EncryptedClientHello; ech == nil {
+			h.Write([]byte{0})
+		} else if ech.Malformed {
+			h.Write([]byte{2})
+		} else {
+			h.Write([]byte{1, ech.Type})
+			binary.Write(h, binary.BigEndian, ech.KDFID)
+			binary.Write(h, binary.BigEndian, ech.AEADID)
+			binary.Write(h, binary.BigEndian, ech.EncLength)
+			if ech.GREASE {
+				h.Write([]byte{1})
+			} else {
+				h.Write([]byte{0})
+			}
 		}
 
-		// Named groups — ungreased, flat big-endian u16 bytes
-		for _, ng := range ch.NamedGroupList {
-			binary.Write(h, binary.BigEndian, ungreaseU16(ng))
+		if normalized {
+			norm = int64(binary.BigEndian.Uint64(h.Sum(nil)[:8]))
+		} else {
+			orig = int64(binary.BigEndian.Uint64(h.Sum(nil)[:8]))
 		}
+	}
+	return
+}
 
-		// EC point formats — flat bytes
-		h.Write(ch.ECPointFormatList)
+// writeFingerprintInputs writes the inputs of the v1 TLS fingerprint to h.
+func (ch *ClientHello) writeFingerprintInputs(h hash.Hash, normalized bool) {
+	// TLS handshake version as u32 (record version excluded)
+	binary.Write(h, binary.BigEndian, uint32(ch.TLSHandshakeVersion))
 
-		// Signature algorithms — ungreased, flat big-endian u16 bytes
-		for _, sa := range ch.SignatureSchemeList {
-			binary.Write(h, binary.BigEndian, ungreaseU16(sa))
-		}
+	// Cipher suites — ungreased, flat big-endian u16 bytes
+	for _, cs := range ch.CipherSuites {
+		binary.Write(h, binary.BigEndian, ungreaseU16(cs))
+	}
 
-		// ALPN — per-string u8 length prefix + bytes; GREASE strings → "\x0a\x0a"
-		for _, proto := range ch.ALPN {
-			if isGREASEALPN(proto) {
-				proto = "\x0a\x0a"
-			}
-			h.Write([]byte{uint8(len(proto))})
-			h.Write([]byte(proto))
-		}
+	// Compression methods — flat bytes
+	h.Write(ch.CompressionMethods)
 
-		// Key share — ungreased (already handled by clienthellod), flat big-endian u16
-		for _, ks := range ch.KeyShare {
-			binary.Write(h, binary.BigEndian, ungreaseU16(ks))
-		}
+	// Extensions — ungreased (already handled by clienthellod), sorted if normalized
+	exts := ch.Extensions
+	if normalized {
+		exts = ch.ExtensionsNormalized
+	}
+	for _, ext := range exts {
+		binary.Write(h, binary.BigEndian, ungreaseU16(ext))
+	}
 
-		// PSK exchange modes — ungreased, flat bytes
-		for _, mode := range ch.PSKKeyExchangeModes {
-			h.Write([]byte{ungreasePSK(mode)})
-		}
+	// Named groups — ungreased, flat big-endian u16 bytes
+	for _, ng := range ch.NamedGroupList {
+		binary.Write(h, binary.BigEndian, ungreaseU16(ng))
+	}
 
-		// Supported versions — ungreased, flat big-endian u16 bytes
-		for _, sv := range ch.SupportedVersions {
-			binary.Write(h, binary.BigEndian, ungreaseU16(sv))
-		}
+	// EC point formats — flat bytes
+	h.Write(ch.ECPointFormatList)
 
-		// Compress certificate — 1-byte list-byte-count + 2 bytes per algo.
-		// DB stores e.g. [2, 0, 2] for brotli: count=2 (byte length), then 0x0002.
-		if len(ch.CertCompressAlgo) > 0 {
-			h.Write([]byte{uint8(2 * len(ch.CertCompressAlgo))})
-			for _, algo := range ch.CertCompressAlgo {
-				binary.Write(h, binary.BigEndian, algo)
-			}
-		}
+	// Signature algorithms — ungreased, flat big-endian u16 bytes
+	for _, sa := range ch.SignatureSchemeList {
+		binary.Write(h, binary.BigEndian, ungreaseU16(sa))
+	}
 
-		// Record size limit — always exactly 2 bytes (value or [0, 0])
-		if len(ch.RecordSizeLimit) >= 2 {
-			h.Write(ch.RecordSizeLimit[:2])
-		} else {
-			h.Write([]byte{0, 0})
+	// ALPN — per-string u8 length prefix + bytes; GREASE strings → "\x0a\x0a"
+	for _, proto := range ch.ALPN {
+		if isGREASEALPN(proto) {
+			proto = "\x0a\x0a"
 		}
+		h.Write([]byte{uint8(len(proto))})
+		h.Write([]byte(proto))
+	}
 
-		if normalized {
-			norm = int64(binary.BigEndian.Uint64(h.Sum(nil)[:8]))
-		} else {
-			orig = int64(binary.BigEndian.Uint64(h.Sum(nil)[:8]))
+	// Key share — ungreased (already handled by clienthellod), flat big-endian u16
+	for _, ks := range ch.KeyShare {
+		binary.Write(h, binary.BigEndian, ungreaseU16(ks))
+	}
+
+	// PSK exchange modes — ungreased, flat bytes
+	for _, mode := range ch.PSKKeyExchangeModes {
+		h.Write([]byte{ungreasePSK(mode)})
+	}
+
+	// Supported versions — ungreased, flat big-endian u16 bytes
+	for _, sv := range ch.SupportedVersions {
+		binary.Write(h, binary.BigEndian, ungreaseU16(sv))
+	}
+
+	// Compress certificate — 1-byte list-byte-count + 2 bytes per algo.
+	// DB stores e.g. [2, 0, 2] for brotli: count=2 (byte length), then 0x0002.
+	if len(ch.CertCompressAlgo) > 0 {
+		h.Write([]byte{uint8(2 * len(ch.CertCompressAlgo))})
+		for _, algo := range ch.CertCompressAlgo {
+			binary.Write(h, binary.BigEndian, algo)
 		}
 	}
-	return
+
+	// Record size limit — always exactly 2 bytes (value or [0, 0])
+	if len(ch.RecordSizeLimit) >= 2 {
+		h.Write(ch.RecordSizeLimit[:2])
+	} else {
+		h.Write([]byte{0, 0})
+	}
 }
 
 // calcNumericID computes the QUIC header fingerprint ID for the gathered initials.
@@ -214,10 +258,24 @@ func (gci *GatheredClientInitials) calcNumericID() uint64 {
 //   - SHA-1 over: sorted parameter IDs (each as u64), then each transport
 //     parameter value decoded to u64. No length prefixes.
 func (qtp *QUICTransportParameters) calcNumericID() uint64 {
+	return qtp.calcNumericIDWithIDs(qtp.QTPIDs)
+}
+
+// calcOrderedNumericID computes the QUIC transport parameters fingerprint ID
+// with the parameter IDs in their original order instead of sorted, which
+// distinguishes clients that differ only in the order they send parameters.
+//
+// Same algorithm as calcNumericID otherwise. This ID is not part of
+// retina_quic_fp.
+func (qtp *QUICTransportParameters) calcOrderedNumericID() uint64 {
+	return qtp.calcNumericIDWithIDs(qtp.QTPIDsOriginal)
+}
+
+func (qtp *QUICTransportParameters) calcNumericIDWithIDs(ids []uint64) uint64 {
 	h := sha1.New() // skipcq: GO-S1025, GSC-G401
 
-	// Parameter IDs first — sorted, each as u64, no count or length prefix
-	for _, id := range qtp.QTPIDs {
+	// Parameter IDs first — each as u64, no count or length prefix
+	for _, id := range ids {
 		updateU64(h, id)
 	}
 
@@ -6,7 +6,9 @@ toolchain go1.22.3
 
 require (
 	github.com/caddyserver/caddy/v2 v2.8.4
+	github.com/dustin/go-humanize v1.0.1
 	github.com/google/gopacket v1.1.19
+	github.com/quic-go/quic-go v0.44.0
 	github.com/refraction-networking/utls v1.6.6
 	go.uber.org/zap v1.27.0
 	golang.org/x/crypto v0.23.0
@@ -35,7 +37,6 @@ require (
 	github.com/dgraph-io/badger/v2 v2.2007.4 // indirect
 	github.com/dgraph-io/ristretto v0.1.0 // indirect
 	github.com/dgryski/go-farm v0.0.0-20200201041132-a6ae2369ad13 // indirect
-	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/go-jose/go-jose/v3 v3.0.3 // indirect
 	github.com/go-kit/kit v0.13.0 // indirect
 	github.com/go-kit/log v0.2.1 // indirect
@@ -78,7 +79,6 @@ require (
 	github.com/prometheus/common v0.48.0 // indirect
 	github.com/prometheus/procfs v0.12.0 // indirect
 	github.com/quic-go/qpack v0.4.0 // indirect
-	github.com/quic-go/quic-go v0.44.0 // indirect
 	github.com/rs/xid v1.5.0 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/shopspring/decimal v1.2.0 // indirect
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Janitor expires entries at their deadlines from a single goroutine,
+// instead of parking one goroutine and one timer per entry.
+//
+// Entries are kept in a min-heap ordered by deadline, with at most one
+// entry per key. The goroutine is started on the first call to Schedule and
+// stopped by Close.
+type Janitor struct {
+	expire func(key, value any)
+
+	mutex   sync.Mutex
+	entries janitorHeap
+	keys    map[any]*janitorEntry
+	closed  bool
+
+	startOnce sync.Once
+	wake      chan struct{}
+	done      chan struct{}
+}
+
+type janitorEntry struct {
+	deadline time.Time
+	key      any
+	value    any
+	index    int // in the heap
+}
+
+// NewJanitor creates a new Janitor calling expire with the key and value
+// of each entry reaching its deadline. expire is called from the janitor
+// goroutine and must not block.
+func NewJanitor(expire func(key, value any)) *Janitor {
+	return &Janitor{
+		expire: expire,
+		keys:   make(map[any]*janitorEntry),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Schedule schedules the expiry of the key/value pair after d, replacing the
+// pending expiry of the key if any. The key must be comparable.
+//
+// The value is retained until the deadline, so it should be small, e.g., a
+// generation token telling if the key still maps to the same entry when it
+// expires, rather than the entry itself.
+//
+// It is a no-op after Close.
+func (j *Janitor) Schedule(d time.Duration, key, value any) {
+	j.startOnce.Do(func() {
+		go j.run()
+	})
+
+	j.mutex.Lock()
+	if j.closed {
+		j.mutex.Unlock()
+		return
+	}
+	deadline := time.Now().Add(d)
+	first := len(j.entries) == 0 || deadline.Before(j.entries[0].deadline)
+	if e, ok := j.keys[key]; ok {
+		e.deadline, e.value = deadline, value
+		heap.Fix(&j.entries, e.index)
+	} else {
+		e = &janitorEntry{
+			deadline: deadline,
+			key:      key,
+			value:    value,
+		}
+		heap.Push(&j.entries, e)
+		j.keys[key] = e
+	}
+	j.mutex.Unlock()
+
+	if first { // new earliest deadline, the goroutine needs to rearm its timer
+		select {
+		case j.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Cancel drops the pending expiry of the key, if any, e.g., when the entry
+// is deleted before its deadline.
+func (j *Janitor) Cancel(key any) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if e, ok := j.keys[key]; ok {
+		heap.Remove(&j.entries, e.index)
+		delete(j.keys, key)
+	}
+}
+
+// Len returns the number of entries pending expiry.
+func (j *Janitor) Len() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.entries)
+}
+
+// Close stops the janitor goroutine. Pending entries are dropped without
+// being expired.
+func (j *Janitor) Close() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.closed {
+		return
+	}
+	j.closed = true
+	j.entries = nil
+	j.keys = nil
+	close(j.done)
+}
+
+func (j *Janitor) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	var expired []*janitorEntry
+	for {
+		j.mutex.Lock()
+		now := time.Now()
+		for len(j.entries) > 0 && !j.entries[0].deadline.After(now) {
+			e := heap.Pop(&j.entries).(*janitorEntry)
+			delete(j.keys, e.key)
+			expired = append(expired, e)
+		}
+		next := time.Hour // idle, woken up by Schedule
+		if len(j.entries) > 0 {
+			next = j.entries[0].deadline.Sub(now)
+		}
+		j.mutex.Unlock()
+
+		for i, e := range expired {
+			j.expire(e.key, e.value)
+			expired[i] = nil // release references
+		}
+		expired = expired[:0]
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next)
+
+		select {
+		case <-j.done:
+			return
+		case <-j.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// janitorHeap implements heap.Interface ordered by deadline.
+type janitorHeap []*janitorEntry
+
+func (h janitorHeap) Len() int           { return len(h) }
+func (h janitorHeap) Less(i, k int) bool { return h[i].deadline.Before(h[k].deadline) }
+
+func (h janitorHeap) Swap(i, k int) {
+	h[i], h[k] = h[k], h[i]
+	h[i].index = i
+	h[k].index = k
+}
+
+func (h *janitorHeap) Push(x any) {
+	e := x.(*janitorEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *janitorHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil // release references
+	*h = old[:n-1]
+	return e
+}
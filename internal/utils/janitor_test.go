@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJanitor(t *testing.T) {
+	var mutex sync.Mutex
+	var expired []any
+	j := NewJanitor(func(key, _ any) {
+		mutex.Lock()
+		expired = append(expired, key)
+		mutex.Unlock()
+	})
+	defer j.Close()
+
+	j.Schedule(60*time.Millisecond, "c", nil)
+	j.Schedule(20*time.Millisecond, "a", nil)
+	j.Schedule(40*time.Millisecond, "b", nil)
+	j.Schedule(time.Hour, "d", nil)
+
+	time.Sleep(200 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(expired) != 3 || expired[0] != "a" || expired[1] != "b" || expired[2] != "c" {
+		t.Fatalf("expired = %v, want [a b c]", expired)
+	}
+	if j.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", j.Len())
+	}
+}
+
+func TestJanitorRescheduleAndCancel(t *testing.T) {
+	var mutex sync.Mutex
+	expired := make(map[any]any)
+	j := NewJanitor(func(key, value any) {
+		mutex.Lock()
+		expired[key] = value
+		mutex.Unlock()
+	})
+	defer j.Close()
+
+	j.Schedule(20*time.Millisecond, "a", 1)
+	j.Schedule(40*time.Millisecond, "a", 2) // replaces the pending expiry of a
+	j.Schedule(20*time.Millisecond, "b", 1)
+	j.Schedule(20*time.Millisecond, "c", 1)
+	j.Cancel("b")
+	j.Cancel("d") // no-op
+
+	if j.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", j.Len())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(expired) != 2 || expired["a"] != 2 || expired["c"] != 1 {
+		t.Fatalf("expired = %v, want map[a:2 c:1]", expired)
+	}
+	if j.Len() != 0 {
+		t.Fatalf("Len() = %d, want 0", j.Len())
+	}
+}
+
+func TestJanitorClose(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	j := NewJanitor(func(_, _ any) {
+		t.Error("expire called after Close")
+	})
+	j.Schedule(50*time.Millisecond, "a", nil)
+	j.Close()
+	j.Close() // idempotent
+	j.Schedule(time.Millisecond, "b", nil)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if j.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", j.Len())
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("goroutines = %d, want at most %d", n, goroutines)
+	}
+}
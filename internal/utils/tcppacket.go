@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// ParseTCPSegment parses the IP packet
+func ParseTCPSegment(buf []byte) (*layers.TCP, error) {
+	var tcp *layers.TCP = &layers.TCP{}
+	err := tcp.DecodeFromBytes(buf, gopacket.NilDecodeFeedback)
+	if err != nil {
+		return nil, err
+	}
+	return tcp, nil
+}
@@ -0,0 +1,68 @@
+package clienthellod
+
+import (
+	"crypto/md5" // skipcq: GSC-G501
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/refraction-networking/clienthellod/internal/utils"
+)
+
+// calcJA3 computes the JA3 and JA3n fingerprint strings of the ClientHello.
+//
+// The JA3 string is built as described by https://github.com/salesforce/ja3:
+//
+//	SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats
+//
+// where each list is made of decimal values joined by "-" and all GREASE
+// values (RFC 8701) are removed. JA3n is identical except that the extensions
+// are sorted in ascending order, which makes it stable against clients that
+// randomize the extension order.
+func (ch *ClientHello) calcJA3() (ja3, ja3n string) {
+	version := strconv.FormatUint(uint64(ch.TLSHandshakeVersion), 10)
+	ciphers := joinNonGREASEUint16(ch.CipherSuites)
+	curves := joinNonGREASEUint16(ch.NamedGroupList)
+
+	pointFormats := make([]string, 0, len(ch.ECPointFormatList))
+	for _, pf := range ch.ECPointFormatList {
+		pointFormats = append(pointFormats, strconv.FormatUint(uint64(pf), 10))
+	}
+
+	ja3 = strings.Join([]string{
+		version,
+		ciphers,
+		joinNonGREASEUint16(ch.Extensions),
+		curves,
+		strings.Join(pointFormats, "-"),
+	}, ",")
+
+	ja3n = strings.Join([]string{
+		version,
+		ciphers,
+		joinNonGREASEUint16(ch.ExtensionsNormalized),
+		curves,
+		strings.Join(pointFormats, "-"),
+	}, ",")
+
+	return
+}
+
+// joinNonGREASEUint16 joins all non-GREASE values in arr as decimal strings
+// separated by "-".
+func joinNonGREASEUint16(arr []uint16) string {
+	strs := make([]string, 0, len(arr))
+	for _, v := range arr {
+		if utils.IsGREASEUint16(v) {
+			continue
+		}
+		strs = append(strs, strconv.FormatUint(uint64(v), 10))
+	}
+	return strings.Join(strs, "-")
+}
+
+// ja3Hash returns the hex-encoded MD5 digest of a JA3 string.
+func ja3Hash(ja3 string) string {
+	sum := md5.Sum([]byte(ja3)) // skipcq: GSC-G401
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,67 @@
+package clienthellod_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	tls "github.com/refraction-networking/utls"
+)
+
+func TestJA3(t *testing.T) {
+	t.Run("Firefox 126", testJA3Firefox126)
+	t.Run("Chrome 120 GREASE", testJA3Chrome120GREASE)
+}
+
+func testJA3Firefox126(t *testing.T) {
+	ch := mustUnmarshalClientHello(t, tlsClientHello_Firefox126)
+
+	const (
+		ja3Truth      = "771,4865-4867-4866-49195-49199-52393-52392-49196-49200-49162-49161-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-34-51-43-13-45-28-65037,29-23-24-25-256-257,0"
+		ja3HashTruth  = "b5001237acdf006056b409cc433726b0"
+		ja3nTruth     = "771,4865-4867-4866-49195-49199-52393-52392-49196-49200-49162-49161-49171-49172-156-157-47-53,0-5-10-11-13-16-23-28-34-35-43-45-51-65037-65281,29-23-24-25-256-257,0"
+		ja3nHashTruth = "6de49d1869679eda9dccc6c9057cfd94"
+	)
+
+	if ch.JA3 != ja3Truth {
+		t.Errorf("JA3 = %s, want %s", ch.JA3, ja3Truth)
+	}
+	if ch.JA3Hash != ja3HashTruth {
+		t.Errorf("JA3Hash = %s, want %s", ch.JA3Hash, ja3HashTruth)
+	}
+	if ch.JA3n != ja3nTruth {
+		t.Errorf("JA3n = %s, want %s", ch.JA3n, ja3nTruth)
+	}
+	if ch.JA3nHash != ja3nHashTruth {
+		t.Errorf("JA3nHash = %s, want %s", ch.JA3nHash, ja3nHashTruth)
+	}
+}
+
+// Chrome randomizes both GREASE values and extension order, so only JA3n
+// is stable across connections.
+func testJA3Chrome120GREASE(t *testing.T) {
+	const (
+		ja3nTruth     = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-5-10-11-13-16-18-23-27-35-43-45-51-17513-65037-65281,29-23-24,0"
+		ja3nHashTruth = "473f0e7c0b6a0f7b049072f4e683068b"
+	)
+
+	for i := 0; i < 4; i++ {
+		ch := mustUnmarshalClientHello(t, utlsClientHello(t, tls.HelloChrome_120))
+
+		if ch.JA3n != ja3nTruth {
+			t.Fatalf("JA3n = %s, want %s", ch.JA3n, ja3nTruth)
+		}
+		if ch.JA3nHash != ja3nHashTruth {
+			t.Fatalf("JA3nHash = %s, want %s", ch.JA3nHash, ja3nHashTruth)
+		}
+		for _, v := range strings.FieldsFunc(ch.JA3, func(r rune) bool { return r == ',' || r == '-' }) {
+			n, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n>>8 == n&0xff && n&0xf == 0xa {
+				t.Fatalf("JA3 contains GREASE value %d: %s", n, ch.JA3)
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package clienthellod
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/refraction-networking/clienthellod/internal/utils"
+)
+
+const (
+	ja4ProtocolTCP  byte = 't' // TLS over TCP
+	ja4ProtocolQUIC byte = 'q' // QUIC
+)
+
+// JA4 returns the JA4 fingerprint of the ClientHello as TLS over TCP,
+// e.g., t13d1516h2_8daaf6152771_e5627efa2ab1.
+//
+// See https://github.com/FoxIO-LLC/ja4 for the specification.
+func (ch *ClientHello) JA4() string {
+	return ch.ja4(ja4ProtocolTCP, false, false)
+}
+
+// JA4R returns the raw (unhashed) form of the JA4 fingerprint, a.k.a. JA4_r.
+func (ch *ClientHello) JA4R() string {
+	return ch.ja4(ja4ProtocolTCP, false, true)
+}
+
+// JA4O returns the JA4 fingerprint computed with cipher suites and extensions
+// in their original order, a.k.a. JA4_o.
+func (ch *ClientHello) JA4O() string {
+	return ch.ja4(ja4ProtocolTCP, true, false)
+}
+
+// JA4RO returns the raw (unhashed) form of the JA4 fingerprint computed with
+// cipher suites and extensions in their original order, a.k.a. JA4_ro.
+func (ch *ClientHello) JA4RO() string {
+	return ch.ja4(ja4ProtocolTCP, true, true)
+}
+
+// ja4 builds the JA4 fingerprint for the given protocol prefix. If original
+// is true, cipher suites and extensions are kept in their original order and
+// SNI/ALPN are not excluded from the extension list. If raw is true, the
+// lists are output as-is instead of being truncated SHA-256 hashes.
+func (ch *ClientHello) ja4(protocol byte, original, raw bool) string {
+	ciphers := make([]uint16, 0, len(ch.CipherSuites))
+	for _, cs := range ch.CipherSuites {
+		if !utils.IsGREASEUint16(cs) {
+			ciphers = append(ciphers, cs)
+		}
+	}
+
+	var hasSNI bool
+	var extensionCount int
+	extensions := make([]uint16, 0, len(ch.Extensions))
+	for _, ext := range ch.Extensions {
+		if utils.IsGREASEUint16(ext) {
+			continue
+		}
+		extensionCount++
+
+		if ext == 0x0000 { // server_name
+			hasSNI = true
+		}
+		if !original && (ext == 0x0000 || ext == 0x0010) { // server_name and ALPN are excluded from sorted list
+			continue
+		}
+		extensions = append(extensions, ext)
+	}
+
+	if !original {
+		sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
+		sort.Slice(extensions, func(i, j int) bool { return extensions[i] < extensions[j] })
+	}
+
+	sigAlgs := make([]uint16, 0, len(ch.SignatureSchemeList))
+	for _, sa := range ch.SignatureSchemeList {
+		if !utils.IsGREASEUint16(sa) {
+			sigAlgs = append(sigAlgs, sa)
+		}
+	}
+
+	// JA4_a
+	sni := byte('i')
+	if hasSNI {
+		sni = 'd'
+	}
+	ja4a := fmt.Sprintf("%c%s%c%02d%02d%s",
+		protocol,
+		ja4Version(ch.ja4TLSVersion()),
+		sni,
+		min(len(ciphers), 99),
+		min(extensionCount, 99),
+		ja4ALPN(ch.ALPN),
+	)
+
+	// JA4_b
+	ja4b := joinHexUint16(ciphers)
+
+	// JA4_c
+	ja4c := joinHexUint16(extensions)
+	if len(sigAlgs) > 0 {
+		ja4c += "_" + joinHexUint16(sigAlgs)
+	}
+
+	if raw {
+		return ja4a + "_" + ja4b + "_" + ja4c
+	}
+
+	if len(ciphers) == 0 {
+		ja4b = ""
+	}
+	if len(extensions) == 0 {
+		ja4c = ""
+	}
+	return ja4a + "_" + ja4Hash(ja4b) + "_" + ja4Hash(ja4c)
+}
+
+// ja4TLSVersion returns the highest non-GREASE version from supported_versions,
+// or the handshake version if supported_versions is absent.
+func (ch *ClientHello) ja4TLSVersion() uint16 {
+	var version uint16
+	for _, v := range ch.SupportedVersions {
+		if !utils.IsGREASEUint16(v) && v > version {
+			version = v
+		}
+	}
+	if version == 0 {
+		version = ch.TLSHandshakeVersion
+	}
+	return version
+}
+
+// ja4Version maps a TLS/DTLS version to its 2-character JA4 representation.
+func ja4Version(v uint16) string {
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	case 0xfeff:
+		return "d1"
+	case 0xfefd:
+		return "d2"
+	case 0xfefc:
+		return "d3"
+	default:
+		return "00"
+	}
+}
+
+// ja4ALPN returns the first and last characters of the first ALPN value.
+// If either is not alphanumeric, the first nibble of the first byte and
+// the last nibble of the last byte in hex are used instead.
+func ja4ALPN(alpn []string) string {
+	if len(alpn) == 0 || len(alpn[0]) == 0 {
+		return "00"
+	}
+
+	first, last := alpn[0][0], alpn[0][len(alpn[0])-1]
+	if isAlphanumeric(first) && isAlphanumeric(last) {
+		return string([]byte{first, last})
+	}
+
+	return hex.EncodeToString([]byte{first})[:1] + hex.EncodeToString([]byte{last})[1:]
+}
+
+func isAlphanumeric(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// joinHexUint16 joins the values in arr as 4-character lowercase hex strings
+// separated by ",".
+func joinHexUint16(arr []uint16) string {
+	strs := make([]string, 0, len(arr))
+	for _, v := range arr {
+		strs = append(strs, fmt.Sprintf("%04x", v))
+	}
+	return strings.Join(strs, ",")
+}
+
+// ja4Hash returns the first 12 hex characters of the SHA-256 digest of s,
+// or "000000000000" if s is empty.
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,77 @@
+package clienthellod_test
+
+import (
+	"testing"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+// clientHello_JA4Example is the Chrome ClientHello used as the example in the
+// JA4 specification (https://github.com/FoxIO-LLC/ja4), with GREASE values
+// added which must be ignored.
+var clientHello_JA4Example = &ClientHello{
+	TLSHandshakeVersion: 0x0303,
+	CipherSuites: []uint16{
+		0x0a0a, // GREASE
+		0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9,
+		0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+	},
+	Extensions: []uint16{
+		0x0a0a, // GREASE
+		0x001b, 0x0000, 0x0033, 0x0010, 0x4469, 0x0017, 0x002d, 0x000d,
+		0x0005, 0x0023, 0x0012, 0x002b, 0xff01, 0x000b, 0x000a, 0x0015,
+		0x0a0a, // GREASE
+	},
+	SignatureSchemeList: []uint16{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601},
+	ALPN:                []string{"h2", "http/1.1"},
+	SupportedVersions:   []uint16{0x0a0a, 0x0304, 0x0303},
+}
+
+func TestJA4(t *testing.T) {
+	t.Run("JA4 Example", testJA4Example)
+	t.Run("Firefox 126", testJA4Firefox126)
+	t.Run("ALPN", testJA4ALPN)
+}
+
+func testJA4Example(t *testing.T) {
+	for _, tc := range []struct{ name, got, want string }{
+		{"JA4", clientHello_JA4Example.JA4(), "t13d1516h2_8daaf6152771_e5627efa2ab1"},
+		{"JA4_r", clientHello_JA4Example.JA4R(), "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0015,0017,001b,0023,002b,002d,0033,4469,ff01_0403,0804,0401,0503,0805,0501,0806,0601"},
+		{"JA4_o", clientHello_JA4Example.JA4O(), "t13d1516h2_acb858a92679_18f69afefd3d"},
+		{"JA4_ro", clientHello_JA4Example.JA4RO(), "t13d1516h2_1301,1302,1303,c02b,c02f,c02c,c030,cca9,cca8,c013,c014,009c,009d,002f,0035_001b,0000,0033,0010,4469,0017,002d,000d,0005,0023,0012,002b,ff01,000b,000a,0015_0403,0804,0401,0503,0805,0501,0806,0601"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %s, want %s", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func testJA4Firefox126(t *testing.T) {
+	ch := mustUnmarshalClientHello(t, tlsClientHello_Firefox126)
+
+	if ja4 := ch.JA4(); ja4 != "t13d1715h2_5b57614c22b0_5c2c66f702b0" {
+		t.Errorf("JA4 = %s, want t13d1715h2_5b57614c22b0_5c2c66f702b0", ja4)
+	}
+	if ja4o := ch.JA4O(); ja4o != "t13d1715h2_5b234860e130_e7cd4f1676b9" {
+		t.Errorf("JA4_o = %s, want t13d1715h2_5b234860e130_e7cd4f1676b9", ja4o)
+	}
+}
+
+func testJA4ALPN(t *testing.T) {
+	for alpn, want := range map[string]string{
+		"":         "00",
+		"h3":       "h3",
+		"http/1.1": "h1",
+		"h":        "hh",
+		"\xab\xcd": "ad",
+		"a\x00":    "60",
+	} {
+		ch := &ClientHello{
+			TLSHandshakeVersion: 0x0303,
+			ALPN:                []string{alpn},
+		}
+		if got := ch.JA4()[8:10]; got != want {
+			t.Errorf("ALPN %q = %s, want %s", alpn, got, want)
+		}
+	}
+}
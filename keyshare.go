@@ -0,0 +1,120 @@
+package clienthellod
+
+import (
+	"github.com/refraction-networking/utls/dicttls"
+)
+
+// Named groups not yet in dicttls.
+const (
+	SupportedGroups_MLKEM512                 uint16 = 0x0200
+	SupportedGroups_MLKEM768                 uint16 = 0x0201
+	SupportedGroups_MLKEM1024                uint16 = 0x0202
+	SupportedGroups_SecP256r1MLKEM768        uint16 = 0x11eb
+	SupportedGroups_X25519MLKEM768           uint16 = 0x11ec
+	SupportedGroups_SecP384r1MLKEM1024       uint16 = 0x11ed
+	SupportedGroups_X25519Kyber768Draft00    uint16 = 0x6399
+	SupportedGroups_X25519Kyber512Draft00    uint16 = 0xfe30 // obsolete code point
+	SupportedGroups_X25519Kyber768Draft00Old uint16 = 0xfe31 // obsolete code point
+	SupportedGroups_P256Kyber768Draft00      uint16 = 0xfe32 // obsolete code point
+)
+
+// keyShareLengths are the key share lengths of the named groups with a
+// fixed-size key share sent by the client. Hybrid groups concatenate the
+// shares of their components.
+var keyShareLengths = map[uint16]uint16{
+	dicttls.SupportedGroups_secp256r1: 65,
+	dicttls.SupportedGroups_secp384r1: 97,
+	dicttls.SupportedGroups_secp521r1: 133,
+	dicttls.SupportedGroups_x25519:    32,
+	dicttls.SupportedGroups_x448:      56,
+	dicttls.SupportedGroups_ffdhe2048: 256,
+	dicttls.SupportedGroups_ffdhe3072: 384,
+	dicttls.SupportedGroups_ffdhe4096: 512,
+	dicttls.SupportedGroups_ffdhe6144: 768,
+	dicttls.SupportedGroups_ffdhe8192: 1024,
+
+	SupportedGroups_MLKEM512:                 800,
+	SupportedGroups_MLKEM768:                 1184,
+	SupportedGroups_MLKEM1024:                1568,
+	SupportedGroups_SecP256r1MLKEM768:        65 + 1184,
+	SupportedGroups_X25519MLKEM768:           1184 + 32,
+	SupportedGroups_SecP384r1MLKEM1024:       97 + 1568,
+	SupportedGroups_X25519Kyber768Draft00:    32 + 1184,
+	SupportedGroups_X25519Kyber512Draft00:    32 + 800,
+	SupportedGroups_X25519Kyber768Draft00Old: 32 + 1184,
+	SupportedGroups_P256Kyber768Draft00:      65 + 1184,
+}
+
+// postQuantumGroups are the named groups resistant to quantum computers,
+// either pure ML-KEM or hybrid with a classical group.
+var postQuantumGroups = map[uint16]bool{
+	SupportedGroups_MLKEM512:                 true,
+	SupportedGroups_MLKEM768:                 true,
+	SupportedGroups_MLKEM1024:                true,
+	SupportedGroups_SecP256r1MLKEM768:        true,
+	SupportedGroups_X25519MLKEM768:           true,
+	SupportedGroups_SecP384r1MLKEM1024:       true,
+	SupportedGroups_X25519Kyber768Draft00:    true,
+	SupportedGroups_X25519Kyber512Draft00:    true,
+	SupportedGroups_X25519Kyber768Draft00Old: true,
+	SupportedGroups_P256Kyber768Draft00:      true,
+}
+
+// IsPostQuantumGroup tells if the named group is a post-quantum one, either
+// pure ML-KEM (or its Kyber draft) or hybrid with a classical group.
+func IsPostQuantumGroup(group uint16) bool {
+	return postQuantumGroups[group]
+}
+
+// KeyShareEntry is a KeyShareEntry of the key_share(51) extension, without
+// the key exchange data itself.
+type KeyShareEntry struct {
+	Group  uint16 `json:"group"`
+	Length uint16 `json:"length"` // length of the key exchange data
+
+	// Malformed is set if the length does not match the known key share
+	// size of the group. It is never set for GREASE or unknown groups.
+	Malformed bool `json:"malformed,omitempty"`
+}
+
+func newKeyShareEntry(group, length uint16) KeyShareEntry {
+	kse := KeyShareEntry{Group: group, Length: length}
+	if wantLength, ok := keyShareLengths[group]; ok {
+		kse.Malformed = length != wantLength
+	}
+	return kse
+}
+
+// PostQuantumSupport classifies how a client supports post-quantum key
+// exchange.
+type PostQuantumSupport string
+
+const (
+	// PostQuantumNone is set when no post-quantum group is offered.
+	PostQuantumNone PostQuantumSupport = "none"
+
+	// PostQuantumAdvertised is set when a post-quantum group is listed in
+	// supported_groups but no well-formed key share is sent for it, so a
+	// HelloRetryRequest is needed to use it.
+	PostQuantumAdvertised PostQuantumSupport = "advertised"
+
+	// PostQuantumKeyShare is set when a well-formed post-quantum key share
+	// is sent.
+	PostQuantumKeyShare PostQuantumSupport = "key_share"
+)
+
+// classifyPostQuantum classifies the post-quantum support of the
+// ClientHello from its supported_groups and key shares.
+func (ch *ClientHello) classifyPostQuantum() PostQuantumSupport {
+	for _, kse := range ch.KeyShareEntries {
+		if postQuantumGroups[kse.Group] && !kse.Malformed {
+			return PostQuantumKeyShare
+		}
+	}
+	for _, group := range ch.NamedGroupList {
+		if postQuantumGroups[group] {
+			return PostQuantumAdvertised
+		}
+	}
+	return PostQuantumNone
+}
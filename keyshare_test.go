@@ -0,0 +1,115 @@
+package clienthellod_test
+
+import (
+	"reflect"
+	"testing"
+
+	tls "github.com/refraction-networking/utls"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+// keyShareClientHello builds a TLS 1.3 ClientHello record offering the
+// given groups and sending the given key shares as-is.
+func keyShareClientHello(t *testing.T, groups []tls.CurveID, keyShares []tls.KeyShare) []byte {
+	t.Helper()
+
+	uconn := tls.UClient(nil, &tls.Config{ServerName: "example.com"}, tls.HelloCustom) // skipcq: GSC-G402
+	if err := uconn.ApplyPreset(&tls.ClientHelloSpec{
+		CipherSuites:       []uint16{tls.TLS_AES_128_GCM_SHA256},
+		CompressionMethods: []byte{0},
+		Extensions: []tls.TLSExtension{
+			&tls.SNIExtension{},
+			&tls.SupportedCurvesExtension{Curves: groups},
+			&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256}},
+			&tls.KeyShareExtension{KeyShares: keyShares},
+			&tls.SupportedVersionsExtension{Versions: []uint16{tls.VersionTLS13}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uconn.BuildHandshakeState(); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := uconn.HandshakeState.Hello.Raw
+	return append([]byte{0x16, 0x03, 0x01, byte(len(hs) >> 8), byte(len(hs))}, hs...)
+}
+
+func TestClientHelloKeyShareEntries(t *testing.T) {
+	const (
+		x25519MLKEM768        = tls.CurveID(SupportedGroups_X25519MLKEM768)
+		x25519Kyber768Draft00 = tls.CurveID(SupportedGroups_X25519Kyber768Draft00)
+	)
+
+	for name, tc := range map[string]struct {
+		groups      []tls.CurveID
+		keyShares   []tls.KeyShare
+		wantEntries []KeyShareEntry
+		wantPQ      PostQuantumSupport
+	}{
+		"Classical": {
+			groups:      []tls.CurveID{tls.X25519, tls.CurveP256},
+			keyShares:   []tls.KeyShare{{Group: tls.X25519, Data: make([]byte, 32)}, {Group: tls.CurveP256, Data: make([]byte, 65)}},
+			wantEntries: []KeyShareEntry{{Group: 0x001d, Length: 32}, {Group: 0x0017, Length: 65}},
+			wantPQ:      PostQuantumNone,
+		},
+		"Advertised": {
+			groups:      []tls.CurveID{x25519MLKEM768, tls.X25519},
+			keyShares:   []tls.KeyShare{{Group: tls.X25519, Data: make([]byte, 32)}},
+			wantEntries: []KeyShareEntry{{Group: 0x001d, Length: 32}},
+			wantPQ:      PostQuantumAdvertised,
+		},
+		"BothHybrids": {
+			groups: []tls.CurveID{x25519MLKEM768, x25519Kyber768Draft00, tls.X25519},
+			keyShares: []tls.KeyShare{
+				{Group: x25519MLKEM768, Data: make([]byte, 1216)},
+				{Group: x25519Kyber768Draft00, Data: make([]byte, 1216)},
+				{Group: tls.X25519, Data: make([]byte, 32)},
+			},
+			wantEntries: []KeyShareEntry{{Group: 0x11ec, Length: 1216}, {Group: 0x6399, Length: 1216}, {Group: 0x001d, Length: 32}},
+			wantPQ:      PostQuantumKeyShare,
+		},
+		"MalformedHybrid": {
+			groups:      []tls.CurveID{x25519MLKEM768, tls.X25519},
+			keyShares:   []tls.KeyShare{{Group: x25519MLKEM768, Data: make([]byte, 1184)}, {Group: tls.X25519, Data: make([]byte, 32)}},
+			wantEntries: []KeyShareEntry{{Group: 0x11ec, Length: 1184, Malformed: true}, {Group: 0x001d, Length: 32}},
+			wantPQ:      PostQuantumAdvertised,
+		},
+		"UnknownGroup": {
+			groups:      []tls.CurveID{0x1234, tls.X25519},
+			keyShares:   []tls.KeyShare{{Group: 0x1234, Data: make([]byte, 7)}, {Group: tls.X25519, Data: make([]byte, 31)}},
+			wantEntries: []KeyShareEntry{{Group: 0x1234, Length: 7}, {Group: 0x001d, Length: 31, Malformed: true}},
+			wantPQ:      PostQuantumNone,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ch := mustUnmarshalClientHello(t, keyShareClientHello(t, tc.groups, tc.keyShares))
+			if !reflect.DeepEqual(ch.KeyShareEntries, tc.wantEntries) {
+				t.Errorf("KeyShareEntries = %+v, want %+v", ch.KeyShareEntries, tc.wantEntries)
+			}
+			if ch.PostQuantum != tc.wantPQ {
+				t.Errorf("PostQuantum = %s, want %s", ch.PostQuantum, tc.wantPQ)
+			}
+		})
+	}
+}
+
+func TestClientHelloKeyShareEntriesParrots(t *testing.T) {
+	firefox := mustUnmarshalClientHello(t, tlsClientHello_Firefox126)
+	if want := []KeyShareEntry{{Group: 0x001d, Length: 32}, {Group: 0x0017, Length: 65}}; !reflect.DeepEqual(firefox.KeyShareEntries, want) {
+		t.Errorf("Firefox KeyShareEntries = %+v, want %+v", firefox.KeyShareEntries, want)
+	}
+	if firefox.PostQuantum != PostQuantumNone {
+		t.Errorf("Firefox PostQuantum = %s, want %s", firefox.PostQuantum, PostQuantumNone)
+	}
+
+	chrome := mustUnmarshalClientHello(t, utlsClientHello(t, tls.HelloChrome_120_PQ))
+	if len(chrome.KeyShareEntries) != 3 || chrome.KeyShareEntries[0].Group != tls.GREASE_PLACEHOLDER ||
+		chrome.KeyShareEntries[1] != (KeyShareEntry{Group: 0x6399, Length: 1216}) {
+		t.Errorf("Chrome KeyShareEntries = %+v", chrome.KeyShareEntries)
+	}
+	if chrome.PostQuantum != PostQuantumKeyShare {
+		t.Errorf("Chrome PostQuantum = %s, want %s", chrome.PostQuantum, PostQuantumKeyShare)
+	}
+}
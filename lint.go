@@ -0,0 +1,249 @@
+package clienthellod
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/refraction-networking/clienthellod/internal/utils"
+	"github.com/refraction-networking/utls/dicttls"
+)
+
+// LintSeverity is the severity of a LintFinding.
+type LintSeverity string
+
+const (
+	// LintError is a violation of a MUST of the specifications, which
+	// conforming implementations do not send.
+	LintError LintSeverity = "error"
+
+	// LintWarning is allowed by the specifications but unlike any known
+	// mainstream implementation.
+	LintWarning LintSeverity = "warning"
+
+	// LintInfo is worth noting but common.
+	LintInfo LintSeverity = "info"
+)
+
+// Machine-readable codes of the LintFindings.
+const (
+	LintDuplicateExtension         = "duplicate_extension"
+	LintPreSharedKeyNotLast        = "pre_shared_key_not_last"
+	LintPSKWithoutKeyExchangeModes = "psk_without_psk_key_exchange_modes"
+	LintEarlyDataWithoutPSK        = "early_data_without_pre_shared_key"
+	LintKeyShareGroupNotSupported  = "key_share_group_not_supported"
+	LintKeyShareOrder              = "key_share_order"
+	LintDuplicateKeyShare          = "duplicate_key_share"
+	LintMalformedKeyShare          = "malformed_key_share"
+	LintTLS13WithoutSupportedVers  = "tls13_without_supported_versions"
+	LintTLS13WithoutKeyShare       = "tls13_without_key_share"
+	LintGREASEPosition             = "grease_position"
+	LintPaddingNotZero             = "padding_not_zero"
+	LintPaddingPosition            = "padding_position"
+	LintPaddingUnnecessary         = "padding_unnecessary"
+	LintMalformedECH               = "malformed_encrypted_client_hello"
+	LintQUICMissingTransportParams = "quic_missing_transport_parameters"
+	LintQUICMissingALPN            = "quic_missing_alpn"
+	LintQUICLegacyTLSVersion       = "quic_legacy_tls_version"
+	LintQUICLegacySessionID        = "quic_legacy_session_id"
+	LintQUICSessionTicketExtension = "quic_session_ticket_extension"
+)
+
+const (
+	lintPaddingThreshold    = 512 // ClientHellos shorter than this are padded by BoringSSL and others
+	lintTLS13CipherSuiteMin = 0x1301
+	lintTLS13CipherSuiteMax = 0x1305
+
+	lintTLS13Version uint16 = 0x0304
+)
+
+// LintFinding is an oddity found in a ClientHello by [ClientHello.Lint].
+type LintFinding struct {
+	Code     string       `json:"code"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Code, f.Message)
+}
+
+// Lint checks the structure of the ClientHello against the specifications
+// and the behavior of mainstream implementations, to help telling a buggy
+// or hand-crafted client from a legitimate one. It returns nil if nothing
+// is found.
+//
+// The ClientHello must have been parsed with [ClientHello.ParseClientHello].
+func (ch *ClientHello) Lint() []LintFinding {
+	var l linter
+	l.lintExtensions(ch)
+	l.lintPreSharedKey(ch)
+	l.lintKeyShare(ch)
+	l.lintSupportedVersions(ch)
+	l.lintGREASE(ch)
+	l.lintPadding(ch)
+	l.lintEncryptedClientHello(ch)
+	return l.findings
+}
+
+// Lint checks the QUIC ClientHello like [ClientHello.Lint], plus the
+// requirements of RFC 9001 on the TLS handshake carried over QUIC.
+func (qch *QUICClientHello) Lint() []LintFinding {
+	var l linter
+	l.findings = qch.ClientHello.Lint()
+
+	if !slices.Contains(qch.Extensions, dicttls.ExtType_quic_transport_parameters) {
+		l.add(LintQUICMissingTransportParams, LintError, "quic_transport_parameters extension is missing (RFC 9001, Section 8.2)")
+	}
+	if !slices.Contains(qch.Extensions, dicttls.ExtType_application_layer_protocol_negotiation) {
+		l.add(LintQUICMissingALPN, LintError, "application_layer_protocol_negotiation extension is missing (RFC 9001, Section 8.1)")
+	}
+	for _, v := range qch.SupportedVersions {
+		if !utils.IsGREASEUint16(v) && v < lintTLS13Version {
+			l.add(LintQUICLegacyTLSVersion, LintError, fmt.Sprintf("TLS version %#04x older than TLS 1.3 offered (RFC 9001, Section 4.2)", v))
+		}
+	}
+	if qch.SessionIDLength > 0 {
+		l.add(LintQUICLegacySessionID, LintWarning, "non-empty legacy_session_id, middlebox compatibility mode is not used with QUIC (RFC 9001, Section 8.4)")
+	}
+	if slices.Contains(qch.Extensions, dicttls.ExtType_session_ticket) {
+		l.add(LintQUICSessionTicketExtension, LintWarning, "TLS 1.2 session_ticket extension offered over QUIC")
+	}
+
+	return l.findings
+}
+
+type linter struct {
+	findings []LintFinding
+}
+
+func (l *linter) add(code string, severity LintSeverity, message string) {
+	l.findings = append(l.findings, LintFinding{Code: code, Severity: severity, Message: message})
+}
+
+func (l *linter) lintExtensions(ch *ClientHello) {
+	seen := make(map[uint16]bool, len(ch.ExtensionRecords))
+	for _, er := range ch.ExtensionRecords {
+		if seen[er.ID] {
+			l.add(LintDuplicateExtension, LintError, fmt.Sprintf("extension %d appears more than once (RFC 8446, Section 4.2)", er.ID))
+		}
+		seen[er.ID] = true
+	}
+}
+
+func (l *linter) lintPreSharedKey(ch *ClientHello) {
+	hasPSK := slices.Contains(ch.Extensions, dicttls.ExtType_pre_shared_key)
+	if hasPSK && ch.Extensions[len(ch.Extensions)-1] != dicttls.ExtType_pre_shared_key {
+		l.add(LintPreSharedKeyNotLast, LintError, "pre_shared_key is not the last extension (RFC 8446, Section 4.2.11)")
+	}
+	if hasPSK && !slices.Contains(ch.Extensions, dicttls.ExtType_psk_key_exchange_modes) {
+		l.add(LintPSKWithoutKeyExchangeModes, LintError, "pre_shared_key sent without psk_key_exchange_modes (RFC 8446, Section 4.2.9)")
+	}
+	if ch.EarlyData && !hasPSK {
+		l.add(LintEarlyDataWithoutPSK, LintError, "early_data sent without pre_shared_key (RFC 8446, Section 4.2.10)")
+	}
+}
+
+func (l *linter) lintKeyShare(ch *ClientHello) {
+	// Both lists have GREASE values replaced by tls.GREASE_PLACEHOLDER
+	var lastIndex int
+	seen := make(map[uint16]bool, len(ch.KeyShareEntries))
+	for _, kse := range ch.KeyShareEntries {
+		if seen[kse.Group] {
+			l.add(LintDuplicateKeyShare, LintError, fmt.Sprintf("more than one key share for group %#04x (RFC 8446, Section 4.2.8)", kse.Group))
+		}
+		seen[kse.Group] = true
+
+		if kse.Malformed {
+			l.add(LintMalformedKeyShare, LintError, fmt.Sprintf("key share for group %#04x is %d bytes, want %d", kse.Group, kse.Length, keyShareLengths[kse.Group]))
+		}
+
+		index := slices.Index(ch.NamedGroupList, kse.Group)
+		if index < 0 {
+			l.add(LintKeyShareGroupNotSupported, LintError, fmt.Sprintf("key share for group %#04x not in supported_groups (RFC 8446, Section 4.2.8)", kse.Group))
+			continue
+		}
+		if index < lastIndex {
+			l.add(LintKeyShareOrder, LintError, fmt.Sprintf("key share for group %#04x not in the order of supported_groups (RFC 8446, Section 4.2.8)", kse.Group))
+		}
+		lastIndex = index
+	}
+}
+
+func (l *linter) lintSupportedVersions(ch *ClientHello) {
+	offersTLS13 := slices.Contains(ch.SupportedVersions, lintTLS13Version)
+	if !slices.Contains(ch.Extensions, dicttls.ExtType_supported_versions) {
+		for _, cs := range ch.CipherSuites {
+			if cs >= lintTLS13CipherSuiteMin && cs <= lintTLS13CipherSuiteMax {
+				offersTLS13 = true
+			}
+		}
+		if offersTLS13 || slices.Contains(ch.Extensions, dicttls.ExtType_key_share) {
+			l.add(LintTLS13WithoutSupportedVers, LintError, "TLS 1.3 offered without supported_versions (RFC 8446, Section 4.2.1)")
+		}
+		return
+	}
+
+	if offersTLS13 && !slices.Contains(ch.Extensions, dicttls.ExtType_key_share) &&
+		!slices.Contains(ch.Extensions, dicttls.ExtType_pre_shared_key) {
+		l.add(LintTLS13WithoutKeyShare, LintError, "TLS 1.3 offered without key_share nor pre_shared_key (RFC 8446, Section 9.2)")
+	}
+}
+
+// lintGREASE checks GREASE values are where BoringSSL, the main GREASE
+// sender, puts them: first in every list, and first or last among the
+// extensions, not counting padding and pre_shared_key.
+func (l *linter) lintGREASE(ch *ClientHello) {
+	checkList := func(name string, list []uint16) {
+		for i, v := range list {
+			if i > 0 && utils.IsGREASEUint16(v) {
+				l.add(LintGREASEPosition, LintWarning, fmt.Sprintf("GREASE value %#04x at position %d of %s", v, i, name))
+			}
+		}
+	}
+	checkList("cipher_suites", ch.CipherSuites)
+	checkList("supported_groups", ch.NamedGroupList)
+	checkList("supported_versions", ch.SupportedVersions)
+	checkList("key_share", ch.KeyShare)
+
+	last := len(ch.ExtensionRecords) - 1
+	for last >= 0 && (ch.ExtensionRecords[last].ID == dicttls.ExtType_padding || ch.ExtensionRecords[last].ID == dicttls.ExtType_pre_shared_key) {
+		last--
+	}
+	for i, er := range ch.ExtensionRecords {
+		if er.GREASE && i != 0 && i != last {
+			l.add(LintGREASEPosition, LintWarning, fmt.Sprintf("GREASE extension %#04x at position %d", er.ID, i))
+		}
+	}
+}
+
+func (l *linter) lintPadding(ch *ClientHello) {
+	for i, er := range ch.ExtensionRecords {
+		if er.ID != dicttls.ExtType_padding {
+			continue
+		}
+
+		if len(bytes.Trim(er.Data, "\x00")) > 0 {
+			l.add(LintPaddingNotZero, LintError, "padding contains non-zero bytes (RFC 7685, Section 3)")
+		}
+
+		next := i + 1
+		if next < len(ch.ExtensionRecords) && ch.ExtensionRecords[next].ID == dicttls.ExtType_pre_shared_key {
+			next++
+		}
+		if next < len(ch.ExtensionRecords) {
+			l.add(LintPaddingPosition, LintWarning, "padding is followed by extensions other than pre_shared_key")
+		}
+
+		// TLS record header, handshake header and padding extension header
+		if unpadded := len(ch.record) - 5 - 4 - 4 - er.Length; er.Length > 0 && unpadded >= lintPaddingThreshold {
+			l.add(LintPaddingUnnecessary, LintInfo, fmt.Sprintf("padding of %d bytes added to a %d-byte ClientHello", er.Length, unpadded))
+		}
+	}
+}
+
+func (l *linter) lintEncryptedClientHello(ch *ClientHello) {
+	if ech := ch.EncryptedClientHello; ech != nil && ech.Malformed {
+		l.add(LintMalformedECH, LintError, "encrypted_client_hello cannot be parsed (draft-ietf-tls-esni, Section 5)")
+	}
+}
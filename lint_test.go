@@ -0,0 +1,190 @@
+package clienthellod_test
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	tls "github.com/refraction-networking/utls"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+// lintClientHello builds a TLS 1.3 ClientHello record with a conforming
+// base set of extensions followed by the given ones.
+func lintClientHello(t *testing.T, cipherSuites []uint16, exts ...tls.TLSExtension) []byte {
+	t.Helper()
+
+	if cipherSuites == nil {
+		cipherSuites = []uint16{tls.GREASE_PLACEHOLDER, tls.TLS_AES_128_GCM_SHA256}
+	}
+	return customClientHello(t, &tls.ClientHelloSpec{
+		CipherSuites:       cipherSuites,
+		CompressionMethods: []byte{0},
+		Extensions: append([]tls.TLSExtension{
+			&tls.SNIExtension{},
+			&tls.SupportedCurvesExtension{Curves: []tls.CurveID{tls.X25519, tls.CurveP256}},
+			&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256}},
+			&tls.SupportedVersionsExtension{Versions: []uint16{tls.VersionTLS13}},
+			&tls.PSKKeyExchangeModesExtension{Modes: []uint8{tls.PskModeDHE}},
+		}, exts...),
+	})
+}
+
+func lintCodes(findings []LintFinding) []string {
+	var codes []string
+	for _, f := range findings {
+		codes = append(codes, f.Code)
+	}
+	return codes
+}
+
+func TestClientHelloLint(t *testing.T) {
+	x25519 := &tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519, Data: make([]byte, 32)}}}
+	psk := &tls.GenericExtension{Id: 41, Data: []byte{0, 7, 0, 1, 0xff, 0, 0, 0, 1, 0, 33, 32}}
+	psk.Data = append(psk.Data, make([]byte, 32)...)
+
+	for name, tc := range map[string]struct {
+		cipherSuites []uint16
+		exts         []tls.TLSExtension
+		want         []string
+	}{
+		"Conforming": {
+			exts: []tls.TLSExtension{x25519},
+		},
+		"DuplicateExtension": {
+			exts: []tls.TLSExtension{x25519, &tls.GenericExtension{Id: 0x1a1b}, &tls.GenericExtension{Id: 0x1a1b}},
+			want: []string{LintDuplicateExtension},
+		},
+		"PreSharedKeyNotLast": {
+			exts: []tls.TLSExtension{x25519, psk, &tls.GenericExtension{Id: 0x1a1b}},
+			want: []string{LintPreSharedKeyNotLast},
+		},
+		"EarlyDataWithoutPSK": {
+			exts: []tls.TLSExtension{x25519, &tls.GenericExtension{Id: 42}},
+			want: []string{LintEarlyDataWithoutPSK},
+		},
+		"KeyShareGroupNotSupported": {
+			exts: []tls.TLSExtension{&tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.CurveP384, Data: make([]byte, 97)}}}},
+			want: []string{LintKeyShareGroupNotSupported},
+		},
+		"KeyShareOrder": {
+			exts: []tls.TLSExtension{&tls.KeyShareExtension{KeyShares: []tls.KeyShare{
+				{Group: tls.CurveP256, Data: make([]byte, 65)},
+				{Group: tls.X25519, Data: make([]byte, 32)},
+			}}},
+			want: []string{LintKeyShareOrder},
+		},
+		"DuplicateKeyShare": {
+			exts: []tls.TLSExtension{&tls.KeyShareExtension{KeyShares: []tls.KeyShare{
+				{Group: tls.X25519, Data: make([]byte, 32)},
+				{Group: tls.X25519, Data: make([]byte, 32)},
+			}}},
+			want: []string{LintDuplicateKeyShare},
+		},
+		"MalformedKeyShare": {
+			exts: []tls.TLSExtension{&tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519, Data: make([]byte, 33)}}}},
+			want: []string{LintMalformedKeyShare},
+		},
+		"TLS13WithoutKeyShare": {
+			want: []string{LintTLS13WithoutKeyShare},
+		},
+		"GREASECipherSuite": {
+			cipherSuites: []uint16{tls.TLS_AES_128_GCM_SHA256, tls.GREASE_PLACEHOLDER},
+			exts:         []tls.TLSExtension{x25519},
+			want:         []string{LintGREASEPosition},
+		},
+		"GREASEExtension": {
+			exts: []tls.TLSExtension{x25519, &tls.UtlsGREASEExtension{}, &tls.GenericExtension{Id: 0x1a1b}},
+			want: []string{LintGREASEPosition},
+		},
+		"GREASEExtensionLast": {
+			exts: []tls.TLSExtension{x25519, &tls.UtlsGREASEExtension{}, &tls.UtlsPaddingExtension{GetPaddingLen: tls.BoringPaddingStyle}},
+		},
+		"PaddingNotZero": {
+			exts: []tls.TLSExtension{x25519, &tls.GenericExtension{Id: 21, Data: []byte{0, 1, 0}}},
+			want: []string{LintPaddingNotZero},
+		},
+		"PaddingPosition": {
+			exts: []tls.TLSExtension{x25519, &tls.GenericExtension{Id: 21, Data: make([]byte, 8)}, &tls.GenericExtension{Id: 0x1a1b}},
+			want: []string{LintPaddingPosition},
+		},
+		"MalformedECH": {
+			exts: []tls.TLSExtension{x25519, &tls.GenericExtension{Id: 0xfe0d, Data: []byte{0x07}}},
+			want: []string{LintMalformedECH},
+		},
+		"PaddingUnnecessary": {
+			exts: []tls.TLSExtension{x25519, &tls.GenericExtension{Id: 0x1a1b, Data: make([]byte, 600)}, &tls.GenericExtension{Id: 21, Data: make([]byte, 8)}},
+			want: []string{LintPaddingUnnecessary},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ch := mustUnmarshalClientHello(t, lintClientHello(t, tc.cipherSuites, tc.exts...))
+			if got := lintCodes(ch.Lint()); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Lint() = %v, want %v", ch.Lint(), tc.want)
+			}
+		})
+	}
+}
+
+func TestClientHelloLintPaddingSize(t *testing.T) {
+	x25519 := &tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519, Data: make([]byte, 32)}}}
+	large := &tls.GenericExtension{Id: 0x1a1b, Data: make([]byte, 600)}
+
+	unpadded := len(lintClientHello(t, nil, x25519, large)) - 5 - 4 // TLS record and handshake headers
+	ch := mustUnmarshalClientHello(t, lintClientHello(t, nil, x25519, large, &tls.GenericExtension{Id: 21, Data: make([]byte, 8)}))
+
+	want := fmt.Sprintf("padding of 8 bytes added to a %d-byte ClientHello", unpadded)
+	if findings := ch.Lint(); len(findings) != 1 || findings[0].Message != want {
+		t.Errorf("Lint() = %v, want %q", findings, want)
+	}
+}
+
+func TestClientHelloLintPSK(t *testing.T) {
+	psk := &tls.GenericExtension{Id: 41, Data: []byte{0, 7, 0, 1, 0xff, 0, 0, 0, 1, 0, 33, 32}}
+	psk.Data = append(psk.Data, make([]byte, 32)...)
+
+	// neither supported_versions nor psk_key_exchange_modes
+	ch := mustUnmarshalClientHello(t, customClientHello(t, &tls.ClientHelloSpec{
+		CipherSuites:       []uint16{tls.TLS_AES_128_GCM_SHA256},
+		CompressionMethods: []byte{0},
+		Extensions:         []tls.TLSExtension{&tls.SupportedCurvesExtension{Curves: []tls.CurveID{tls.X25519}}, psk},
+	}))
+	want := []string{LintPSKWithoutKeyExchangeModes, LintTLS13WithoutSupportedVers}
+	if got := lintCodes(ch.Lint()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint() = %v, want %v", ch.Lint(), want)
+	}
+}
+
+func TestClientHelloLintParrots(t *testing.T) {
+	if findings := mustUnmarshalClientHello(t, tlsClientHello_Firefox126).Lint(); findings != nil {
+		t.Errorf("Firefox126: Lint() = %v", findings)
+	}
+	for _, id := range []tls.ClientHelloID{tls.HelloChrome_100, tls.HelloChrome_120, tls.HelloChrome_120_PQ, tls.HelloFirefox_120, tls.HelloSafari_16_0} {
+		if findings := mustUnmarshalClientHello(t, utlsClientHello(t, id)).Lint(); findings != nil {
+			t.Errorf("%s: Lint() = %v", id.Str(), findings)
+		}
+	}
+}
+
+func TestQUICClientHelloLint(t *testing.T) {
+	raw, err := os.ReadFile("internal/testdata/QUIC_ClientHello_Chrome_124.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	qch, err := ParseQUICClientHello(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findings := qch.Lint(); findings != nil {
+		t.Errorf("Chrome124: Lint() = %v", findings)
+	}
+
+	// a TLS over TCP ClientHello carried over QUIC
+	qch = &QUICClientHello{ClientHello: *mustUnmarshalClientHello(t, tlsClientHello_Firefox126)}
+	want := []string{LintQUICMissingTransportParams, LintQUICLegacyTLSVersion, LintQUICLegacySessionID, LintQUICSessionTicketExtension}
+	if got := lintCodes(qch.Lint()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint() = %v, want %v", qch.Lint(), want)
+	}
+}
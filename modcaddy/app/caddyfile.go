@@ -1,10 +1,13 @@
 package app
 
 import (
+	"strconv"
+
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/dustin/go-humanize"
 )
 
 func init() {
@@ -14,12 +17,17 @@ func init() {
 /*
 Caddyfile syntax:
 
-	trojan {
-		validfor 5s [2s]
+	clienthellod {
+		tls_ttl 5s
+		quic_ttl 30s
+		tls_max_entries 10000
+		tls_max_bytes 64MiB
+		quic_max_entries 10000
+		quic_max_bytes 128MiB
 	}
 
-The second argument is an optional cleaning interval, if left out, it will be the same
-as the first argument (validfor).
+The max_entries and max_bytes options are optional, if left out, the corresponding
+fingerprint store is unbounded.
 */
 func parseCaddyfile(d *caddyfile.Dispenser, _ interface{}) (interface{}, error) {
 	app := &Reservoir{
@@ -64,6 +72,42 @@ func parseCaddyfile(d *caddyfile.Dispenser, _ interface{}) (interface{}, error)
 				if len(args) > 1 {
 					return nil, d.Err("too many arguments")
 				}
+			case "tls_max_entries", "quic_max_entries": // max number of entries in the store
+				opt := d.Val()
+				if !d.NextArg() {
+					return nil, d.ArgErr()
+				}
+				maxEntries, err := strconv.Atoi(d.Val())
+				if err != nil || maxEntries < 0 {
+					return nil, d.Errf("invalid %s: %s", opt, d.Val())
+				}
+				if opt == "tls_max_entries" {
+					app.TlsMaxEntries = maxEntries
+				} else {
+					app.QuicMaxEntries = maxEntries
+				}
+
+				if d.NextArg() {
+					return nil, d.Err("too many arguments")
+				}
+			case "tls_max_bytes", "quic_max_bytes": // max approximated memory usage of the store
+				opt := d.Val()
+				if !d.NextArg() {
+					return nil, d.ArgErr()
+				}
+				maxBytes, err := humanize.ParseBytes(d.Val())
+				if err != nil || maxBytes > 1<<62 {
+					return nil, d.Errf("invalid %s: %s", opt, d.Val())
+				}
+				if opt == "tls_max_bytes" {
+					app.TlsMaxBytes = int64(maxBytes)
+				} else {
+					app.QuicMaxBytes = int64(maxBytes)
+				}
+
+				if d.NextArg() {
+					return nil, d.Err("too many arguments")
+				}
 			}
 		}
 	}
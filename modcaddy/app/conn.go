@@ -0,0 +1,54 @@
+package app
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/refraction-networking/clienthellod"
+)
+
+// ClientHelloConn is a net.Conn carrying the TLS ClientHello read from it,
+// so that every request served over the connection is associated with the
+// ClientHello, even after it expires from the TLSFingerprinter, e.g., on
+// HTTP/1.1 keep-alive and HTTP/2 connections.
+type ClientHelloConn struct {
+	net.Conn
+	clientHello *clienthellod.ClientHello
+}
+
+// NewClientHelloConn returns conn carrying the TLS ClientHello read from it.
+func NewClientHelloConn(conn net.Conn, ch *clienthellod.ClientHello) *ClientHelloConn {
+	return &ClientHelloConn{Conn: conn, clientHello: ch}
+}
+
+// ClientHello returns a copy of the TLS ClientHello read from the
+// connection, which the caller may modify, e.g., to set its UserAgent.
+func (c *ClientHelloConn) ClientHello() *clienthellod.ClientHello {
+	ch := *c.clientHello // shared by every request of the connection
+	return &ch
+}
+
+// NetConn returns the wrapped connection.
+func (c *ClientHelloConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// lookupConnClientHello returns the TLS ClientHello carried by the
+// connection serving the request, set by caddyhttp, or nil if none is found.
+// The connection is unwrapped, e.g., from a *tls.Conn, until a
+// ClientHelloConn is found.
+func lookupConnClientHello(req *http.Request) *clienthellod.ClientHello {
+	conn, _ := req.Context().Value(caddyhttp.ConnCtxKey).(net.Conn)
+	for conn != nil {
+		switch c := conn.(type) {
+		case *ClientHelloConn:
+			return c.ClientHello()
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
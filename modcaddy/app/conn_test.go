@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/refraction-networking/clienthellod"
+)
+
+// tlsConn wraps a connection like *tls.Conn does.
+type tlsConn struct {
+	net.Conn
+	conn net.Conn
+}
+
+func (c *tlsConn) NetConn() net.Conn { return c.conn }
+
+func TestLookupClientHelloPinned(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	pinned := &clienthellod.ClientHello{HexID: "aabbccdd"}
+	conn := &tlsConn{conn: NewClientHelloConn(server, pinned)}
+
+	tfp := clienthellod.NewTLSFingerprinterWithTimeout(time.Minute)
+	defer tfp.Close()
+	r := &Reservoir{tlsFingerprinter: tfp}
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), caddyhttp.ConnCtxKey, net.Conn(conn)))
+
+	// The ClientHello is found although it is not in the TLSFingerprinter,
+	// e.g., after it expired on a keep-alive connection.
+	ch := r.LookupClientHello(req)
+	if ch == nil || ch.HexID != "aabbccdd" {
+		t.Fatalf("LookupClientHello() = %+v, want the pinned ClientHello", ch)
+	}
+	ch.UserAgent = "modified"
+	if ch = r.LookupClientHello(req); ch.UserAgent != "" {
+		t.Error("LookupClientHello() returned the pinned ClientHello instead of a copy")
+	}
+
+	// Without a pinned ClientHello, the TLSFingerprinter is looked up.
+	req = req.WithContext(context.WithValue(req.Context(), caddyhttp.ConnCtxKey, server))
+	if ch = r.LookupClientHello(req); ch != nil {
+		t.Errorf("LookupClientHello() without a pinned ClientHello = %+v, want nil", ch)
+	}
+}
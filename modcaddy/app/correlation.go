@@ -0,0 +1,219 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/quic-go/quic-go"
+	"github.com/refraction-networking/clienthellod"
+	"github.com/refraction-networking/clienthellod/internal/utils"
+)
+
+// quicConnCtxKey is the context key of the quic.Connection serving an
+// HTTP/3 request, set by caddyhttp.
+//
+// It copies the unexported quicConnCtxKey of caddyhttp (server.go in Caddy
+// v2.8.4, the version required in go.mod), so it must be checked again when
+// upgrading Caddy: if it is renamed, HTTP/3 requests silently fall back to
+// the IP-level correlation.
+const quicConnCtxKey caddy.CtxKey = "quic_conn"
+
+// quicCorrelator associates QUIC fingerprints with HTTP requests.
+//
+// HTTP/3 requests are associated with the fingerprint of the QUIC
+// connection serving them, first looked up by the UDP source address of the
+// connection and then pinned to the connection until it is closed, so it
+// survives connection migration and the expiry of the fingerprint.
+//
+// Other requests, e.g., HTTP/2 requests of a client which also connected
+// over QUIC, can only be associated by IP address, with the fingerprints of
+// every QUIC connection seen from the IP address within the TTL.
+type quicCorrelator struct {
+	mutex      sync.Mutex
+	conns      map[quic.Connection]*quicConnEntry
+	candidates map[string]map[string]quicCandidateEntry // IP: UDP source address: entry
+	janitor    *utils.Janitor
+
+	ttl time.Duration
+}
+
+type quicConnEntry struct {
+	from string // UDP source address of the connection when first seen
+	qfp  *clienthellod.QUICFingerprint
+}
+
+type quicCandidate struct {
+	ip, from string
+}
+
+// quicCandidateEntry caches the fingerprint of a QUIC connection, so that
+// IP-level lookups do not generate it again for every request.
+type quicCandidateEntry struct {
+	seen time.Time
+	qfp  *clienthellod.QUICFingerprint
+}
+
+func newQUICCorrelator(ttl time.Duration) *quicCorrelator {
+	c := &quicCorrelator{
+		conns:      make(map[quic.Connection]*quicConnEntry),
+		candidates: make(map[string]map[string]quicCandidateEntry),
+		ttl:        ttl,
+	}
+	c.janitor = utils.NewJanitor(func(key, seen any) {
+		candidate := key.(quicCandidate)
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if set := c.candidates[candidate.ip]; set != nil && set[candidate.from].seen.Equal(seen.(time.Time)) {
+			delete(set, candidate.from)
+			if len(set) == 0 {
+				delete(c.candidates, candidate.ip)
+			}
+		}
+	})
+	return c
+}
+
+// lookupConn returns the fingerprint of the QUIC connection serving an
+// HTTP/3 request, or nil if none is found.
+func (c *quicCorrelator) lookupConn(req *http.Request, qfpr *clienthellod.QUICFingerprinter) *clienthellod.QUICFingerprint {
+	conn, _ := req.Context().Value(quicConnCtxKey).(quic.Connection)
+	if conn != nil {
+		c.mutex.Lock()
+		entry := c.conns[conn]
+		c.mutex.Unlock()
+		if entry != nil {
+			c.addCandidate(entry.from, entry.qfp)
+			qfp := *entry.qfp // the pinned fingerprint is shared by every request of the connection
+			return &qfp
+		}
+	}
+
+	qfp := qfpr.Peek(req.RemoteAddr)
+	if qfp == nil {
+		return nil
+	}
+	qfp.Correlation = clienthellod.QUICCorrelationConnection
+	cached := *qfp // callers may modify qfp, e.g., to set its UserAgent
+	c.addCandidate(req.RemoteAddr, &cached)
+
+	if conn != nil {
+		c.mutex.Lock()
+		if _, ok := c.conns[conn]; !ok {
+			c.conns[conn] = &quicConnEntry{from: req.RemoteAddr, qfp: &cached}
+			context.AfterFunc(conn.Context(), func() {
+				c.mutex.Lock()
+				defer c.mutex.Unlock()
+				delete(c.conns, conn)
+			})
+		}
+		c.mutex.Unlock()
+	}
+	return qfp
+}
+
+// lookupIP returns the most recent fingerprint of the QUIC connections seen
+// from the IP address of remoteAddr, or nil if none is found.
+//
+// Candidates recorded without a fingerprint, see Reservoir.NewQUICVisitor,
+// are looked up from qfpr once and then cached.
+func (c *quicCorrelator) lookupIP(remoteAddr string, qfpr *clienthellod.QUICFingerprinter) *clienthellod.QUICFingerprint {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return nil
+	}
+
+	type candidate struct {
+		from string
+		quicCandidateEntry
+	}
+	c.mutex.Lock()
+	candidates := make([]candidate, 0, len(c.candidates[ip]))
+	for from, entry := range c.candidates[ip] {
+		candidates = append(candidates, candidate{from, entry})
+	}
+	c.mutex.Unlock()
+
+	entries := make([]quicCandidateEntry, 0, len(candidates))
+	for _, cand := range candidates {
+		if cand.qfp == nil {
+			if cand.qfp = qfpr.Peek(cand.from); cand.qfp == nil {
+				continue
+			}
+			c.cacheCandidate(ip, cand.from, cand.quicCandidateEntry)
+		}
+		entries = append(entries, cand.quicCandidateEntry)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	latest := slices.MaxFunc(entries, func(a, b quicCandidateEntry) int {
+		return a.seen.Compare(b.seen)
+	})
+	qfp := *latest.qfp // the cached fingerprint is shared by every lookup
+	qfp.Correlation = clienthellod.QUICCorrelationIPUnique
+	for _, entry := range entries {
+		if entry.qfp.HexID != qfp.HexID {
+			qfp.Correlation = clienthellod.QUICCorrelationIPAmbiguous
+			break
+		}
+	}
+	return &qfp
+}
+
+// cacheCandidate caches the fingerprint of a candidate recorded without
+// one, unless it was seen again in the meantime.
+func (c *quicCorrelator) cacheCandidate(ip, from string, entry quicCandidateEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if cur, ok := c.candidates[ip][from]; ok && cur.qfp == nil && cur.seen.Equal(entry.seen) {
+		c.candidates[ip][from] = entry
+	}
+}
+
+// lastCandidate returns the UDP source address of the QUIC connection most
+// recently seen from the IP address.
+func (c *quicCorrelator) lastCandidate(ip string) (from string, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var seen time.Time
+	for f, entry := range c.candidates[ip] {
+		if !ok || entry.seen.After(seen) {
+			from, seen, ok = f, entry.seen, true
+		}
+	}
+	return from, ok
+}
+
+// addCandidate records the fingerprint of a QUIC connection from the UDP
+// source address for the IP-level fallback, until the TTL passes without it
+// being seen again. qfp may be nil if it is not known yet.
+func (c *quicCorrelator) addCandidate(from string, qfp *clienthellod.QUICFingerprint) {
+	ip, _, err := net.SplitHostPort(from)
+	if err != nil {
+		return
+	}
+
+	seen := time.Now()
+	c.mutex.Lock()
+	set := c.candidates[ip]
+	if set == nil {
+		set = make(map[string]quicCandidateEntry)
+		c.candidates[ip] = set
+	}
+	set[from] = quicCandidateEntry{seen: seen, qfp: qfp}
+	c.mutex.Unlock()
+
+	c.janitor.Schedule(c.ttl, quicCandidate{ip: ip, from: from}, seen)
+}
+
+// Close stops expiring candidates.
+func (c *quicCorrelator) Close() {
+	c.janitor.Close()
+}
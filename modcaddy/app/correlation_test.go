@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/refraction-networking/clienthellod"
+)
+
+// fakeQUICConn is a quic.Connection which only implements Context.
+type fakeQUICConn struct {
+	quic.Connection
+	ctx context.Context
+}
+
+func (c *fakeQUICConn) Context() context.Context { return c.ctx }
+
+func newChrome125Fingerprinter(t *testing.T, from string) *clienthellod.QUICFingerprinter {
+	t.Helper()
+
+	qfpr := clienthellod.NewQUICFingerprinterWithTimeout(time.Minute)
+	t.Cleanup(qfpr.Close)
+	for _, name := range []string{"QUIC_IETF_Chrome_125_PKN1.bin", "QUIC_IETF_Chrome_125_PKN2.bin"} {
+		p, err := os.ReadFile("../../internal/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := qfpr.HandlePacket(from, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return qfpr
+}
+
+func TestQUICCorrelator(t *testing.T) {
+	const from = "192.0.2.1:50000"
+	qfpr := newChrome125Fingerprinter(t, from)
+	c := newQUICCorrelator(time.Minute)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := &fakeQUICConn{ctx: ctx}
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req.RemoteAddr = from
+	req = req.WithContext(context.WithValue(req.Context(), quicConnCtxKey, quic.Connection(conn)))
+
+	qfp := c.lookupConn(req, qfpr)
+	if qfp == nil {
+		t.Fatal("lookupConn() = nil")
+	}
+	if qfp.Correlation != clienthellod.QUICCorrelationConnection {
+		t.Errorf("lookupConn().Correlation = %s, want %s", qfp.Correlation, clienthellod.QUICCorrelationConnection)
+	}
+	hexID := qfp.HexID
+	qfp.UserAgent = "modified"
+
+	// The fingerprint stays pinned to the connection and cached for
+	// IP-level lookups after the fingerprinter forgets it.
+	qfpr.Pop(from)
+	if qfp = c.lookupConn(req, qfpr); qfp == nil || qfp.HexID != hexID || qfp.UserAgent != "" {
+		t.Errorf("lookupConn() after Pop = %+v, want the pinned fingerprint %s", qfp, hexID)
+	}
+	if qfp = c.lookupIP("192.0.2.1:443", qfpr); qfp == nil || qfp.HexID != hexID || qfp.UserAgent != "" {
+		t.Fatalf("lookupIP() = %+v, want the cached fingerprint %s", qfp, hexID)
+	}
+	if qfp.Correlation != clienthellod.QUICCorrelationIPUnique {
+		t.Errorf("lookupIP().Correlation = %s, want %s", qfp.Correlation, clienthellod.QUICCorrelationIPUnique)
+	}
+	if qfp = c.lookupIP("198.51.100.1:443", qfpr); qfp != nil {
+		t.Errorf("lookupIP() of another IP address = %+v, want nil", qfp)
+	}
+
+	// A more recent connection from the same IP address with another
+	// fingerprint makes the IP-level correlation ambiguous.
+	c.addCandidate("192.0.2.1:50001", &clienthellod.QUICFingerprint{HexID: "other"})
+	if qfp = c.lookupIP("192.0.2.1:443", qfpr); qfp == nil || qfp.HexID != "other" {
+		t.Fatalf("lookupIP() = %+v, want the most recent fingerprint", qfp)
+	}
+	if qfp.Correlation != clienthellod.QUICCorrelationIPAmbiguous {
+		t.Errorf("lookupIP().Correlation = %s, want %s", qfp.Correlation, clienthellod.QUICCorrelationIPAmbiguous)
+	}
+
+	// Closing the connection unpins the fingerprint.
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for c.lookupConn(req, qfpr) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("lookupConn() after the connection is closed did not return nil")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQUICCorrelatorExpiry(t *testing.T) {
+	qfpr := clienthellod.NewQUICFingerprinter()
+	defer qfpr.Close()
+	c := newQUICCorrelator(10 * time.Millisecond)
+	defer c.Close()
+
+	c.addCandidate("192.0.2.1:50000", &clienthellod.QUICFingerprint{HexID: "expired"})
+	if qfp := c.lookupIP("192.0.2.1:443", qfpr); qfp == nil {
+		t.Fatal("lookupIP() = nil")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for c.lookupIP("192.0.2.1:443", qfpr) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("lookupIP() after the TTL did not return nil")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.candidates) != 0 {
+		t.Errorf("len(candidates) = %d, want 0", len(c.candidates))
+	}
+}
+
+func TestReservoirQUICVisitor(t *testing.T) {
+	const from = "192.0.2.1:50000"
+	qfpr := newChrome125Fingerprinter(t, from)
+	r := &Reservoir{quicFingerprinter: qfpr, quicCorrelator: newQUICCorrelator(time.Minute)}
+	defer r.quicCorrelator.Close()
+
+	if _, ok := r.GetLastQUICVisitor("192.0.2.1"); ok {
+		t.Fatal("GetLastQUICVisitor() found a visitor before any is recorded")
+	}
+	r.NewQUICVisitor("192.0.2.1", from)
+	if last, ok := r.GetLastQUICVisitor("192.0.2.1"); !ok || last != from {
+		t.Fatalf("GetLastQUICVisitor() = %s, %v, want %s, true", last, ok, from)
+	}
+
+	// The fingerprint of the visitor is looked up once, then cached.
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req.RemoteAddr = "192.0.2.1:443"
+	qfp := r.LookupQUICFingerprint(req)
+	if qfp == nil || qfp.Correlation != clienthellod.QUICCorrelationIPUnique {
+		t.Fatalf("LookupQUICFingerprint() = %+v, want an ip_unique fingerprint", qfp)
+	}
+	qfpr.Pop(from)
+	if cached := r.LookupQUICFingerprint(req); cached == nil || cached.HexID != qfp.HexID {
+		t.Errorf("LookupQUICFingerprint() after Pop = %+v, want the cached fingerprint %s", cached, qfp.HexID)
+	}
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"net"
+	"sync"
+
+	"github.com/refraction-networking/clienthellod"
+)
+
+// quicPacketConns are the open connections returned by
+// Reservoir.WrapQUICPacketConn. Caddy keeps its QUIC listeners open across
+// configuration reloads, so the connections are switched to the
+// QUICFingerprinter of the last started Reservoir.
+var quicPacketConns sync.Map // *quicPacketConn: struct{}
+
+type quicPacketConn struct {
+	*clienthellod.QUICPacketConn
+}
+
+// Close implements net.PacketConn.
+func (c *quicPacketConn) Close() error {
+	quicPacketConns.Delete(c)
+	return c.QUICPacketConn.Close()
+}
+
+// WrapQUICPacketConn wraps pc to fingerprint the QUIC Initial packets read
+// from it into the reservoir, and into the reservoirs of the configurations
+// loaded later.
+func (r *Reservoir) WrapQUICPacketConn(pc net.PacketConn) net.PacketConn { // skipcq: GO-W1029
+	c := &quicPacketConn{clienthellod.NewQUICPacketConn(pc, r.quicFingerprinter)}
+	quicPacketConns.Store(c, struct{}{})
+	return c
+}
+
+// switchQUICPacketConns makes every open connection returned by
+// WrapQUICPacketConn save the fingerprints into the reservoir.
+func (r *Reservoir) switchQUICPacketConns() { // skipcq: GO-W1029
+	quicPacketConns.Range(func(c, _ any) bool {
+		c.(*quicPacketConn).SetFingerprinter(r.quicFingerprinter)
+		return true
+	})
+}
@@ -2,7 +2,8 @@ package app
 
 import (
 	"errors"
-	"sync"
+	"net"
+	"net/http"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
@@ -42,9 +43,25 @@ type Reservoir struct {
 	// a longer TTL for QUIC.
 	QuicTTL caddy.Duration `json:"quic_ttl,omitempty"`
 
-	tlsFingerprinter        *clienthellod.TLSFingerprinter
-	quicFingerprinter       *clienthellod.QUICFingerprinter
-	mapLastQUICVisitorPerIP *sync.Map // sometimes even when a complete QUIC handshake is done, client decide to connect using HTTP/2
+	// TlsMaxEntries and TlsMaxBytes bound the number of TLS fingerprints
+	// and their approximated memory usage. When either bound is exceeded,
+	// the least recently used fingerprints are evicted. Zero means unbounded.
+	TlsMaxEntries int   `json:"tls_max_entries,omitempty"`
+	TlsMaxBytes   int64 `json:"tls_max_bytes,omitempty"`
+
+	// QuicMaxEntries and QuicMaxBytes bound the number of QUIC fingerprints
+	// (including the ones being gathered) and their approximated memory usage.
+	// When either bound is exceeded, the least recently used fingerprints are
+	// evicted. Zero means unbounded.
+	QuicMaxEntries int   `json:"quic_max_entries,omitempty"`
+	QuicMaxBytes   int64 `json:"quic_max_bytes,omitempty"`
+
+	tlsStore  *clienthellod.LRUStore // nil if unbounded
+	quicStore *clienthellod.LRUStore // nil if unbounded
+
+	tlsFingerprinter  *clienthellod.TLSFingerprinter
+	quicFingerprinter *clienthellod.QUICFingerprinter
+	quicCorrelator    *quicCorrelator // sometimes even when a complete QUIC handshake is done, client decide to connect using HTTP/2
 
 	logger *zap.Logger
 }
@@ -65,6 +82,18 @@ func (Reservoir) CaddyModule() caddy.ModuleInfo { // skipcq: GO-W1029
 	}
 }
 
+// TLSStore returns the bounded store of the TLSFingerprinter, or nil if
+// the store is unbounded.
+func (r *Reservoir) TLSStore() *clienthellod.LRUStore { // skipcq: GO-W1029
+	return r.tlsStore
+}
+
+// QUICStore returns the bounded store of the QUICFingerprinter, or nil if
+// the store is unbounded.
+func (r *Reservoir) QUICStore() *clienthellod.LRUStore { // skipcq: GO-W1029
+	return r.quicStore
+}
+
 // TLSFingerprinter returns the TLSFingerprinter instance.
 func (r *Reservoir) TLSFingerprinter() *clienthellod.TLSFingerprinter { // skipcq: GO-W1029
 	return r.tlsFingerprinter
@@ -75,25 +104,66 @@ func (r *Reservoir) QUICFingerprinter() *clienthellod.QUICFingerprinter { // ski
 	return r.quicFingerprinter
 }
 
-// NewQUICVisitor updates the map entry for the given IP address.
+// NewQUICVisitor records a QUIC connection from fullKey, its UDP source
+// address, for the IP-level lookups of LookupQUICFingerprint.
+//
+// Deprecated: QUIC connections are recorded by LookupQUICFingerprint when
+// serving HTTP/3 requests.
 func (r *Reservoir) NewQUICVisitor(ip, fullKey string) { // skipcq: GO-W1029
-	r.mapLastQUICVisitorPerIP.Store(ip, fullKey)
-
-	// delete it after TTL if not updated
-	go func() {
-		<-time.After(time.Duration(r.QuicTTL))
-		r.mapLastQUICVisitorPerIP.CompareAndDelete(ip, fullKey)
-	}()
+	if host, _, err := net.SplitHostPort(fullKey); err != nil || host != ip {
+		return // the correlator derives the IP address from fullKey
+	}
+	r.quicCorrelator.addCandidate(fullKey, nil)
 }
 
-// GetLastQUICVisitor returns the last QUIC visitor for the given IP address.
+// GetLastQUICVisitor returns the UDP source address of the QUIC connection
+// most recently seen from the IP address.
+//
+// Deprecated: use LookupQUICFingerprint, whose Correlation tells how
+// confidently the fingerprint is associated with the request.
 func (r *Reservoir) GetLastQUICVisitor(ip string) (string, bool) { // skipcq: GO-W1029
-	if v, ok := r.mapLastQUICVisitorPerIP.Load(ip); ok {
-		if fullKey, ok := v.(string); ok {
-			return fullKey, true
+	return r.quicCorrelator.lastCandidate(ip)
+}
+
+// LookupClientHello returns the TLS ClientHello sent by the client of the
+// request, or nil if none is found. For HTTP/3 requests, it is the
+// ClientHello carried in the QUIC Initial packets.
+//
+// For other requests, the ClientHello pinned to the connection serving the
+// request by the clienthellod listener wrapper is looked up first, see
+// ClientHelloConn, and then the TLSFingerprinter by the remote address.
+func (r *Reservoir) LookupClientHello(req *http.Request) *clienthellod.ClientHello { // skipcq: GO-W1029
+	if req.ProtoMajor <= 2 {
+		if ch := lookupConnClientHello(req); ch != nil {
+			return ch
+		}
+		return r.tlsFingerprinter.Peek(req.RemoteAddr)
+	}
+
+	qfp := r.LookupQUICFingerprint(req)
+	if qfp == nil || qfp.ClientInitials == nil || qfp.ClientInitials.ClientHello == nil {
+		return nil
+	}
+	return &qfp.ClientInitials.ClientHello.ClientHello
+}
+
+// LookupQUICFingerprint returns the QUIC fingerprint of the client of the
+// request, or nil if none is found. Its Correlation tells how it is
+// associated with the request.
+//
+// For HTTP/3 requests, the fingerprint of the QUIC connection serving the
+// request is looked up first. Otherwise, or if it is not found, the
+// fingerprints of the QUIC connections seen from the same IP address are
+// used, which may belong to other clients behind the same NAT.
+func (r *Reservoir) LookupQUICFingerprint(req *http.Request) *clienthellod.QUICFingerprint { // skipcq: GO-W1029
+	// Lookups use Peek (non-blocking) instead of PeekAwait. PeekAwait blocks for up to
+	// quic_ttl on entries still being gathered, which stalls goroutines indefinitely.
+	if req.ProtoMajor == 3 {
+		if qfp := r.quicCorrelator.lookupConn(req, r.quicFingerprinter); qfp != nil {
+			return qfp
 		}
 	}
-	return "", false
+	return r.quicCorrelator.lookupIP(req.RemoteAddr, r.quicFingerprinter)
 }
 
 // Start implements Start() of caddy.App.
@@ -102,6 +172,12 @@ func (r *Reservoir) Start() error { // skipcq: GO-W1029
 		return errors.New("ttl must be a positive duration")
 	}
 
+	if r.TlsMaxEntries < 0 || r.TlsMaxBytes < 0 || r.QuicMaxEntries < 0 || r.QuicMaxBytes < 0 {
+		return errors.New("max_entries and max_bytes must not be negative")
+	}
+
+	r.switchQUICPacketConns()
+
 	r.logger.Info("clienthellod reservoir is started")
 
 	return nil
@@ -111,14 +187,35 @@ func (r *Reservoir) Start() error { // skipcq: GO-W1029
 func (r *Reservoir) Stop() error { // skipcq: GO-W1029
 	r.quicFingerprinter.Close()
 	r.tlsFingerprinter.Close()
+	r.quicCorrelator.Close()
+
+	if r.tlsStore != nil {
+		r.logger.Info("clienthellod TLS fingerprint store is stopped", zap.Uint64("evictions", r.tlsStore.Evictions()))
+	}
+	if r.quicStore != nil {
+		r.logger.Info("clienthellod QUIC fingerprint store is stopped", zap.Uint64("evictions", r.quicStore.Evictions()))
+	}
 	return nil
 }
 
 // Provision implements Provision() of caddy.Provisioner.
 func (r *Reservoir) Provision(ctx caddy.Context) error { // skipcq: GO-W1029
-	r.tlsFingerprinter = clienthellod.NewTLSFingerprinterWithTimeout(time.Duration(r.TlsTTL))
-	r.quicFingerprinter = clienthellod.NewQUICFingerprinterWithTimeout(time.Duration(r.QuicTTL))
-	r.mapLastQUICVisitorPerIP = new(sync.Map)
+	if r.TlsMaxEntries > 0 || r.TlsMaxBytes > 0 {
+		r.tlsStore = clienthellod.NewLRUStore(r.TlsMaxEntries, r.TlsMaxBytes)
+		r.tlsFingerprinter = clienthellod.NewTLSFingerprinterWithStore(r.tlsStore)
+		r.tlsFingerprinter.SetTimeout(time.Duration(r.TlsTTL))
+	} else {
+		r.tlsFingerprinter = clienthellod.NewTLSFingerprinterWithTimeout(time.Duration(r.TlsTTL))
+	}
+
+	if r.QuicMaxEntries > 0 || r.QuicMaxBytes > 0 {
+		r.quicStore = clienthellod.NewLRUStore(r.QuicMaxEntries, r.QuicMaxBytes)
+		r.quicFingerprinter = clienthellod.NewQUICFingerprinterWithStore(r.quicStore)
+		r.quicFingerprinter.SetTimeout(time.Duration(r.QuicTTL))
+	} else {
+		r.quicFingerprinter = clienthellod.NewQUICFingerprinterWithTimeout(time.Duration(r.QuicTTL))
+	}
+	r.quicCorrelator = newQUICCorrelator(time.Duration(r.QuicTTL))
 
 	r.logger = ctx.Logger(r)
 
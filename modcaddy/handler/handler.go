@@ -1,20 +1,27 @@
 package handler
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net"
 	"net/http"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/refraction-networking/clienthellod"
 	"github.com/refraction-networking/clienthellod/modcaddy/app"
 	"go.uber.org/zap"
 )
 
+const (
+	DEFAULT_TLS_HEADER             = "X-TLS-Fingerprint"
+	DEFAULT_QUIC_HEADER            = "X-QUIC-Fingerprint"
+	DEFAULT_QUIC_CONFIDENCE_HEADER = "X-QUIC-Fingerprint-Confidence"
+)
+
 func init() {
 	caddy.RegisterModule(Handler{})
 	httpcaddyfile.RegisterHandlerDirective("clienthellod", func(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
@@ -26,17 +33,59 @@ func init() {
 	})
 }
 
+// Handler serves the fingerprints of the client as JSON. In every mode, it
+// also fills the http.request.clienthellod.* placeholders of the request,
+// e.g., {http.request.clienthellod.tls.norm_hex_id}.
 type Handler struct {
 	// TLS enables handler to look up TLS ClientHello from reservoir.
 	//
-	// Mutually exclusive with QUIC. One and only one of TLS or QUIC must be true.
+	// One and only one of TLS, QUIC, Placeholders or Forward must be true.
 	TLS bool `json:"tls,omitempty"`
 
 	// QUIC enables handler to look up QUIC ClientHello from reservoir.
 	//
-	// Mutually exclusive with TLS. One and only one of TLS or QUIC must be true.
+	// One and only one of TLS, QUIC, Placeholders or Forward must be true.
 	QUIC bool `json:"quic,omitempty"`
 
+	// Placeholders makes the handler only fill the placeholders and pass the
+	// request to the next handler, e.g., to use the fingerprints in
+	// reverse_proxy headers or access logs.
+	//
+	// One and only one of TLS, QUIC, Placeholders or Forward must be true.
+	Placeholders bool `json:"placeholders,omitempty"`
+
+	// Forward makes the handler attach the fingerprints of the client to the
+	// request as headers and pass it to the next handler, e.g., to put
+	// clienthellod in front of an application with reverse_proxy.
+	//
+	// One and only one of TLS, QUIC, Placeholders or Forward must be true.
+	Forward bool `json:"forward,omitempty"`
+
+	// TLSHeader is the request header set to the NormHexID of the TLS
+	// ClientHello in Forward mode. Defaults to X-TLS-Fingerprint.
+	TLSHeader string `json:"tls_header,omitempty"`
+
+	// QUICHeader is the request header set to the HexID of the QUIC
+	// fingerprint in Forward mode. Defaults to X-QUIC-Fingerprint.
+	QUICHeader string `json:"quic_header,omitempty"`
+
+	// QUICConfidenceHeader is the request header set to the Correlation of
+	// the QUIC fingerprint in Forward mode, so the upstream can tell the
+	// fingerprints of the QUIC connection serving the request from the ones
+	// only associated with it by IP address. Defaults to
+	// X-QUIC-Fingerprint-Confidence.
+	QUICConfidenceHeader string `json:"quic_confidence_header,omitempty"`
+
+	// RawHeader, if set, is the request header set to the raw TLS
+	// ClientHello, base64-encoded, in Forward mode.
+	RawHeader string `json:"raw_header,omitempty"`
+
+	// KeepClientHeaders keeps the client-supplied copies of the headers
+	// above in Forward mode. By default, they are removed from the request
+	// before setting them, so a client cannot spoof them when its
+	// fingerprints are not found.
+	KeepClientHeaders bool `json:"keep_client_headers,omitempty"`
+
 	logger    *zap.Logger
 	reservoir *app.Reservoir
 }
@@ -61,10 +110,25 @@ func (h *Handler) Provision(ctx caddy.Context) error { // skipcq: GO-W1029
 		h.logger.Info("clienthellod handler reservoir loaded.")
 	}
 
-	if h.TLS && h.QUIC {
-		return errors.New("clienthellod handler: mutually exclusive TLS and QUIC are both enabled")
-	} else if !(h.TLS || h.QUIC) {
-		return errors.New("clienthellod handler: one and only one of TLS or QUIC must be enabled")
+	if h.modes() != 1 {
+		return errors.New("clienthellod handler: one and only one of TLS, QUIC, placeholders or forward must be enabled")
+	}
+	if !h.Forward && (h.TLSHeader != "" || h.QUICHeader != "" || h.QUICConfidenceHeader != "" || h.RawHeader != "" || h.KeepClientHeaders) {
+		return errors.New("clienthellod handler: header options are only allowed with forward")
+	}
+	if h.Forward {
+		if h.TLSHeader == "" {
+			h.TLSHeader = DEFAULT_TLS_HEADER
+		}
+		if h.QUICHeader == "" {
+			h.QUICHeader = DEFAULT_QUIC_HEADER
+		}
+		if h.QUICConfidenceHeader == "" {
+			h.QUICConfidenceHeader = DEFAULT_QUIC_CONFIDENCE_HEADER
+		}
+		if h.KeepClientHeaders {
+			h.logger.Warn("clienthellod handler keeps client-supplied fingerprint headers, which clients may spoof when their fingerprints are not found")
+		}
 	}
 
 	h.logger.Info("clienthellod handler provisioned.")
@@ -72,11 +136,29 @@ func (h *Handler) Provision(ctx caddy.Context) error { // skipcq: GO-W1029
 	return nil
 }
 
+// modes returns the number of modes enabled.
+func (h *Handler) modes() int { // skipcq: GO-W1029
+	var modes int
+	for _, enabled := range []bool{h.TLS, h.QUIC, h.Placeholders, h.Forward} {
+		if enabled {
+			modes++
+		}
+	}
+	return modes
+}
+
 // ServeHTTP
 func (h *Handler) ServeHTTP(wr http.ResponseWriter, req *http.Request, next caddyhttp.Handler) error { // skipcq: GO-W1029
 	h.logger.Debug("Serving HTTP to " + req.RemoteAddr + " on Protocol " + req.Proto)
 
-	if h.TLS {
+	repl := req.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	addPlaceholders(repl, req, h.reservoir)
+
+	if h.Placeholders {
+		return next.ServeHTTP(wr, req)
+	} else if h.Forward {
+		return h.serveForward(wr, req, next)
+	} else if h.TLS {
 		if req.ProtoMajor <= 2 {
 			return h.serveTLS(wr, req, next)
 		}
@@ -88,11 +170,40 @@ func (h *Handler) ServeHTTP(wr http.ResponseWriter, req *http.Request, next cadd
 	return next.ServeHTTP(wr, req)
 }
 
+// serveForward sets the fingerprint headers of the request and passes it to
+// the next handler.
+func (h *Handler) serveForward(wr http.ResponseWriter, req *http.Request, next caddyhttp.Handler) error { // skipcq: GO-W1029
+	if !h.KeepClientHeaders {
+		req.Header.Del(h.TLSHeader)
+		req.Header.Del(h.QUICHeader)
+		req.Header.Del(h.QUICConfidenceHeader)
+		if h.RawHeader != "" {
+			req.Header.Del(h.RawHeader)
+		}
+	}
+
+	if ch := h.reservoir.LookupClientHello(req); ch != nil {
+		req.Header.Set(h.TLSHeader, ch.NormHexID)
+		if h.RawHeader != "" {
+			req.Header.Set(h.RawHeader, base64.StdEncoding.EncodeToString(ch.Raw()))
+		}
+	} else {
+		h.logger.Debug(fmt.Sprintf("Unable to fetch TLS ClientHello to forward for %s", req.RemoteAddr))
+	}
+
+	if qfp := h.reservoir.LookupQUICFingerprint(req); qfp != nil {
+		req.Header.Set(h.QUICHeader, qfp.HexID)
+		req.Header.Set(h.QUICConfidenceHeader, string(qfp.Correlation))
+	}
+
+	return next.ServeHTTP(wr, req)
+}
+
 // serveTLS handles HTTP/1.0, HTTP/1.1, H2 requests by looking up the
 // ClientHello from the reservoir and writing it to the response.
 func (h *Handler) serveTLS(wr http.ResponseWriter, req *http.Request, next caddyhttp.Handler) error { // skipcq: GO-W1029
 	// get the client hello from the reservoir
-	ch := h.reservoir.TLSFingerprinter().Peek(req.RemoteAddr)
+	ch := h.reservoir.LookupClientHello(req)
 	if ch == nil {
 		h.logger.Debug(fmt.Sprintf("Unable to fetch TLS ClientHello sent by %s, maybe not TLS connection?", req.RemoteAddr))
 		return next.ServeHTTP(wr, req)
@@ -102,13 +213,11 @@ func (h *Handler) serveTLS(wr http.ResponseWriter, req *http.Request, next caddy
 	ch.UserAgent = req.UserAgent()
 
 	// dump JSON
-	var b []byte
-	var err error
-	if req.URL.Query().Get("beautify") == "true" {
-		b, err = json.MarshalIndent(ch, "", "  ")
-	} else {
-		b, err = json.Marshal(ch)
+	var v any = ch
+	if withExtensionData(req) {
+		v = &clientHelloWithExtensionData{ch, ch.ExtensionRecordsHex()}
 	}
+	b, err := responseJSON(req, v)
 	if err != nil {
 		h.logger.Error("failed to marshal TLS ClientHello into JSON", zap.Error(err))
 		return next.ServeHTTP(wr, req)
@@ -136,36 +245,18 @@ func (h *Handler) serveTLS(wr http.ResponseWriter, req *http.Request, next caddy
 // serveTLSOverH3 handles HTTP/3 requests for the TLS handler by extracting the
 // TLS ClientHello that clienthellod captured from the QUIC Initial packets.
 func (h *Handler) serveTLSOverH3(wr http.ResponseWriter, req *http.Request, next caddyhttp.Handler) error { // skipcq: GO-W1029
-	from := req.RemoteAddr
-	// Use Peek (non-blocking) instead of PeekAwait. PeekAwait blocks for up to
-	// quic_ttl on entries still being gathered, which stalls goroutines indefinitely.
-	qfp := h.reservoir.QUICFingerprinter().Peek(from)
-	if qfp == nil {
-		// Fallback: look up the most recent QUIC session for this IP (handles connection reuse/migration)
-		ip, _, splitErr := net.SplitHostPort(req.RemoteAddr)
-		if splitErr == nil {
-			if lastFrom, ok := h.reservoir.GetLastQUICVisitor(ip); ok {
-				qfp = h.reservoir.QUICFingerprinter().Peek(lastFrom)
-			}
-		}
-		if qfp == nil {
-			h.logger.Debug(fmt.Sprintf("Unable to fetch QUIC data for TLS-over-H3 from %s", req.RemoteAddr))
-			return next.ServeHTTP(wr, req)
-		}
-	}
-	if qfp.ClientInitials == nil || qfp.ClientInitials.ClientHello == nil {
+	ch := h.reservoir.LookupClientHello(req)
+	if ch == nil {
+		h.logger.Debug(fmt.Sprintf("Unable to fetch QUIC data for TLS-over-H3 from %s", req.RemoteAddr))
 		return next.ServeHTTP(wr, req)
 	}
-	ch := &qfp.ClientInitials.ClientHello.ClientHello
 	ch.UserAgent = req.UserAgent()
 
-	var b []byte
-	var err error
-	if req.URL.Query().Get("beautify") == "true" {
-		b, err = json.MarshalIndent(ch, "", "  ")
-	} else {
-		b, err = json.Marshal(ch)
+	var v any = ch
+	if withExtensionData(req) {
+		v = &clientHelloWithExtensionData{ch, ch.ExtensionRecordsHex()}
 	}
+	b, err := responseJSON(req, v)
 	if err != nil {
 		h.logger.Error("failed to marshal TLS-over-H3 ClientHello into JSON", zap.Error(err))
 		return next.ServeHTTP(wr, req)
@@ -181,40 +272,9 @@ func (h *Handler) serveTLSOverH3(wr http.ResponseWriter, req *http.Request, next
 // serveQUIC handles QUIC requests by looking up the ClientHello from the
 // reservoir and writing it to the response.
 func (h *Handler) serveQUIC(wr http.ResponseWriter, req *http.Request, next caddyhttp.Handler) error { // skipcq: GO-W1029
-	var from string
-	if req.ProtoMajor == 3 {
-		from = req.RemoteAddr
-		h.logger.Debug(fmt.Sprintf("Fetching QUIC Fingerprint directly sent by QUIC client at %s", from))
-	} else {
-		// Get IP part of the RemoteAddr
-		ip, _, err := net.SplitHostPort(req.RemoteAddr)
-		if err != nil {
-			h.logger.Error(fmt.Sprintf("Can't split IP from %s: %v", req.RemoteAddr, err))
-			return next.ServeHTTP(wr, req)
-		}
-
-		// Get the last QUIC visitor
-		var ok bool
-		from, ok = h.reservoir.GetLastQUICVisitor(ip)
-		if !ok {
-			h.logger.Debug(fmt.Sprintf("Can't find last QUIC visitor for %s", ip))
-			return next.ServeHTTP(wr, req)
-		}
-
-		h.logger.Debug(fmt.Sprintf("Fetching most recent QUIC Fingerprint sent by %s for TLS client at %s", from, req.RemoteAddr))
-	}
-
-	// get the client hello from the reservoir (non-blocking Peek to avoid goroutine stalls)
-	qfp := h.reservoir.QUICFingerprinter().Peek(from)
-	if qfp == nil && req.ProtoMajor == 3 {
-		// H3 direct lookup failed — try visitor fallback (handles port migration)
-		ip, _, splitErr := net.SplitHostPort(req.RemoteAddr)
-		if splitErr == nil {
-			if lastFrom, ok := h.reservoir.GetLastQUICVisitor(ip); ok {
-				qfp = h.reservoir.QUICFingerprinter().Peek(lastFrom)
-			}
-		}
-	}
+	// get the QUIC fingerprint from the reservoir, either of this QUIC
+	// connection or of the QUIC connections from the same IP address
+	qfp := h.reservoir.LookupQUICFingerprint(req)
 	if qfp == nil {
 		h.logger.Debug(fmt.Sprintf("Unable to fetch QUIC fingerprint sent by %s", req.RemoteAddr))
 		return next.ServeHTTP(wr, req)
@@ -222,29 +282,23 @@ func (h *Handler) serveQUIC(wr http.ResponseWriter, req *http.Request, next cadd
 
 	// h.logger.Debug(fmt.Sprintf("Fetched QUIC fingerprint for %s", req.RemoteAddr))
 
-	// If this is a QUIC request, we record the IP address as a QUIC visitor
-	// so this QUIC fingerprint is associated with the IP address and can be
-	// fetched for even HTTP-over-TLS (TCP-based) requests.
-	if req.ProtoMajor == 3 {
-		// Get IP part of the RemoteAddr
-		ip, _, ipErr := net.SplitHostPort(req.RemoteAddr)
-		if ipErr == nil {
-			h.reservoir.NewQUICVisitor(ip, req.RemoteAddr)
-		} else {
-			h.logger.Error(fmt.Sprintf("Can't extract IP from %s: %v", req.RemoteAddr, ipErr))
-		}
-	}
-
 	qfp.UserAgent = req.UserAgent()
 
 	// dump JSON
-	var b []byte
-	var err error
-	if req.URL.Query().Get("beautify") == "true" {
-		b, err = json.MarshalIndent(qfp, "", "  ")
-	} else {
-		b, err = json.Marshal(qfp)
+	var v any = qfp
+	if withExtensionData(req) && qfp.ClientInitials != nil && qfp.ClientInitials.ClientHello != nil {
+		v = &quicFingerprintWithExtensionData{
+			QUICFingerprint: qfp,
+			ClientInitials: &gatheredClientInitialsWithExtensionData{
+				GatheredClientInitials: qfp.ClientInitials,
+				ClientHello: &quicClientHelloWithExtensionData{
+					qfp.ClientInitials.ClientHello,
+					qfp.ClientInitials.ClientHello.ExtensionRecordsHex(),
+				},
+			},
+		}
 	}
+	b, err := responseJSON(req, v)
 	if err != nil {
 		h.logger.Error("failed to marshal QUIC fingerprint into JSON", zap.Error(err))
 		return next.ServeHTTP(wr, req)
@@ -269,25 +323,86 @@ func (h *Handler) serveQUIC(wr http.ResponseWriter, req *http.Request, next cadd
 	return nil
 }
 
+// responseJSON marshals v into JSON, indented if the beautify query
+// parameter is true.
+func responseJSON(req *http.Request, v any) ([]byte, error) {
+	if req.URL.Query().Get("beautify") == "true" {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// withExtensionData tells if the extension_data query parameter asks for
+// the hex-encoded data of every ClientHello extension, e.g., to debug new
+// browser releases.
+func withExtensionData(req *http.Request) bool {
+	return req.URL.Query().Get("extension_data") == "true"
+}
+
+// clientHelloWithExtensionData overrides the extension_records of a
+// ClientHello in JSON with the ones including the hex-encoded data.
+type clientHelloWithExtensionData struct {
+	*clienthellod.ClientHello
+	ExtensionRecords []clienthellod.ExtensionRecordHex `json:"extension_records"`
+}
+
+// quicFingerprintWithExtensionData does the same as
+// clientHelloWithExtensionData for the ClientHello of a QUICFingerprint.
+type quicFingerprintWithExtensionData struct {
+	*clienthellod.QUICFingerprint
+	ClientInitials *gatheredClientInitialsWithExtensionData `json:"ClientInitials"`
+}
+
+type gatheredClientInitialsWithExtensionData struct {
+	*clienthellod.GatheredClientInitials
+	ClientHello *quicClientHelloWithExtensionData `json:"client_hello,omitempty"`
+}
+
+type quicClientHelloWithExtensionData struct {
+	*clienthellod.QUICClientHello
+	ExtensionRecords []clienthellod.ExtensionRecordHex `json:"extension_records"`
+}
+
 // UnmarshalCaddyfile unmarshals Caddyfile tokens into h.
 func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error { // skipcq: GO-W1029
 	for d.Next() {
 		for d.NextBlock(0) {
-			switch d.Val() {
-			case "tls":
-				if h.TLS {
-					return d.Err("clienthellod: repeated tls in block")
-				} else if h.QUIC {
-					return d.Err("clienthellod: tls and quic are mutually exclusive in one block")
+			switch opt := d.Val(); opt {
+			case "tls", "quic", "placeholders", "forward":
+				if h.modes() > 0 {
+					return d.Err("clienthellod: only one of tls, quic, placeholders and forward is allowed in one block")
+				}
+				switch opt {
+				case "tls":
+					h.TLS = true
+				case "quic":
+					h.QUIC = true
+				case "placeholders":
+					h.Placeholders = true
+				case "forward":
+					h.Forward = true
+				}
+			case "tls_header", "quic_header", "quic_confidence_header", "raw_header":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				switch opt {
+				case "tls_header":
+					h.TLSHeader = d.Val()
+				case "quic_header":
+					h.QUICHeader = d.Val()
+				case "quic_confidence_header":
+					h.QUICConfidenceHeader = d.Val()
+				case "raw_header":
+					h.RawHeader = d.Val()
 				}
-				h.TLS = true
-			case "quic":
-				if h.QUIC {
-					return d.Err("clienthellod: repeated quic in block")
-				} else if h.TLS {
-					return d.Err("clienthellod: tls and quic are mutually exclusive in one block")
+				if d.NextArg() {
+					return d.Err("too many arguments")
 				}
-				h.QUIC = true
+			case "keep_client_headers":
+				h.KeepClientHeaders = true
+			default:
+				return d.Errf("clienthellod: unknown option %s", opt)
 			}
 		}
 	}
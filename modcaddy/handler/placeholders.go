@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/refraction-networking/clienthellod"
+	"github.com/refraction-networking/clienthellod/modcaddy/app"
+)
+
+const placeholderPrefix = "http.request.clienthellod."
+
+// tlsPlaceholders are the placeholders filled from the TLS ClientHello of a
+// request, without placeholderPrefix.
+var tlsPlaceholders = map[string]func(ch *clienthellod.ClientHello) any{
+	"tls.hex_id":         func(ch *clienthellod.ClientHello) any { return ch.HexID },
+	"tls.norm_hex_id":    func(ch *clienthellod.ClientHello) any { return ch.NormHexID },
+	"tls.hex_id_v2":      func(ch *clienthellod.ClientHello) any { return ch.HexIDv2 },
+	"tls.norm_hex_id_v2": func(ch *clienthellod.ClientHello) any { return ch.NormHexIDv2 },
+	"tls.ja3":            func(ch *clienthellod.ClientHello) any { return ch.JA3 },
+	"tls.ja3_hash":       func(ch *clienthellod.ClientHello) any { return ch.JA3Hash },
+	"tls.ja3n":           func(ch *clienthellod.ClientHello) any { return ch.JA3n },
+	"tls.ja3n_hash":      func(ch *clienthellod.ClientHello) any { return ch.JA3nHash },
+	"tls.alpn":           func(ch *clienthellod.ClientHello) any { return strings.Join(ch.ALPN, ",") },
+	"tls.sni":            func(ch *clienthellod.ClientHello) any { return ch.ServerName },
+	"tls.post_quantum":   func(ch *clienthellod.ClientHello) any { return string(ch.PostQuantum) },
+}
+
+// quicPlaceholders are the placeholders filled from the QUIC fingerprint of
+// a request, without placeholderPrefix.
+var quicPlaceholders = map[string]func(qfp *clienthellod.QUICFingerprint) any{
+	"quic.hex_id":      func(qfp *clienthellod.QUICFingerprint) any { return qfp.HexID },
+	"quic.ja4":         func(qfp *clienthellod.QUICFingerprint) any { return qfp.JA4 },
+	"quic.ja4_o":       func(qfp *clienthellod.QUICFingerprint) any { return qfp.JA4O },
+	"quic.correlation": func(qfp *clienthellod.QUICFingerprint) any { return string(qfp.Correlation) },
+}
+
+// addPlaceholders registers the http.request.clienthellod.* placeholders of
+// the request. The fingerprints are looked up from the reservoir only when
+// a placeholder is first used. Placeholders of a fingerprint not found are
+// empty, and so are all of them for matchers and handlers running before
+// the Handler, as they are only registered here.
+func addPlaceholders(repl *caddy.Replacer, req *http.Request, reservoir *app.Reservoir) {
+	lookupClientHello := sync.OnceValue(func() *clienthellod.ClientHello {
+		return reservoir.LookupClientHello(req)
+	})
+	lookupQUICFingerprint := sync.OnceValue(func() *clienthellod.QUICFingerprint {
+		return reservoir.LookupQUICFingerprint(req)
+	})
+
+	repl.Map(func(key string) (any, bool) {
+		key, ok := strings.CutPrefix(key, placeholderPrefix)
+		if !ok {
+			return nil, false
+		}
+
+		if f, ok := tlsPlaceholders[key]; ok {
+			if ch := lookupClientHello(); ch != nil {
+				return f(ch), true
+			}
+			return "", true
+		}
+		if f, ok := quicPlaceholders[key]; ok {
+			if qfp := lookupQUICFingerprint(); qfp != nil {
+				return f(qfp), true
+			}
+			return "", true
+		}
+		return nil, false
+	})
+}
@@ -33,7 +33,16 @@ func init() {
 //		tls
 //	}
 type ListenerWrapper struct {
+	// TCP fingerprints the TLS ClientHello of the connections accepted by
+	// the wrapped TCP listeners.
 	TCP bool `json:"tcp,omitempty"`
+
+	// UDP fingerprints QUIC Initial packets sniffed from raw IP sockets,
+	// which requires CAP_NET_RAW and sees the UDP traffic of every port.
+	//
+	// It is a fallback for servers which cannot be bound to the clienthellod
+	// network, see Network, with which the HTTP/3 server fingerprints the
+	// packets it reads.
 	UDP bool `json:"udp,omitempty"`
 
 	logger       *zap.Logger
@@ -161,6 +170,11 @@ func (l *tlsListener) Accept() (net.Conn, error) {
 
 		_ = conn.SetReadDeadline(time.Time{})
 
+		// Pin the ClientHello to the connection, so that requests served
+		// after it expires from the reservoir still find it.
+		if ch := l.reservoir.TLSFingerprinter().Peek(conn.RemoteAddr().String()); ch != nil {
+			return app.NewClientHelloConn(rewindConn, ch), nil
+		}
 		return rewindConn, nil
 	}
 }
@@ -0,0 +1,66 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/refraction-networking/clienthellod/modcaddy/app"
+)
+
+const (
+	// Network is the network type to bind Caddy servers to, e.g., with
+	// "bind clienthellod/0.0.0.0" in the Caddyfile, to fingerprint QUIC
+	// Initial packets as the HTTP/3 server reads them, without raw sockets.
+	// TCP is listened on as usual, fingerprinted by the ListenerWrapper.
+	Network = "clienthellod"
+
+	// NetworkHTTP3 is the network type of the HTTP/3 server of servers bound
+	// to Network.
+	NetworkHTTP3 = "clienthellod-udp"
+)
+
+func init() {
+	caddy.RegisterNetwork(Network, listenTCP)
+	caddy.RegisterNetwork(NetworkHTTP3, listenUDP)
+	caddyhttp.RegisterNetworkHTTP3(Network, NetworkHTTP3)
+}
+
+// listenTCP listens on TCP, as Caddy would without the clienthellod network.
+func listenTCP(ctx context.Context, _, addr string, cfg net.ListenConfig) (any, error) {
+	na, err := caddy.ParseNetworkAddress("tcp/" + addr)
+	if err != nil {
+		return nil, err
+	}
+	return na.Listen(ctx, 0, cfg)
+}
+
+// listenUDP listens on UDP and fingerprints the QUIC Initial packets read
+// into the reservoir.
+func listenUDP(ctx context.Context, _, addr string, cfg net.ListenConfig) (any, error) {
+	caddyCtx, ok := ctx.(caddy.Context)
+	if !ok {
+		return nil, errors.New("clienthellod: listening outside of a Caddy context")
+	}
+	a, err := caddyCtx.AppIfConfigured(app.CaddyAppID)
+	if err != nil {
+		return nil, fmt.Errorf("clienthellod: %w", err)
+	}
+
+	na, err := caddy.ParseNetworkAddress("udp/" + addr)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := na.Listen(ctx, 0, cfg)
+	if err != nil {
+		return nil, err
+	}
+	pc, ok := ln.(net.PacketConn)
+	if !ok {
+		return nil, fmt.Errorf("clienthellod: unexpected UDP listener type %T", ln)
+	}
+	return a.(*app.Reservoir).WrapQUICPacketConn(pc), nil
+}
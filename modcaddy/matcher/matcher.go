@@ -0,0 +1,305 @@
+package matcher
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/refraction-networking/clienthellod"
+	"github.com/refraction-networking/clienthellod/modcaddy/app"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(Matcher{})
+}
+
+// Matcher matches requests by the fingerprints of the TLS ClientHello or
+// QUIC Initial packets sent by the client, as captured by the clienthellod
+// listener wrapper.
+//
+// Every option holds a list of values, any of which matches. When more than
+// one option is set, all of them must match. A request is never matched
+// when the fingerprint needed by an option is not found, e.g., QUIC
+// options for clients which never connected over QUIC.
+//
+// By default, QUIC fingerprints are only matched when they are of the QUIC
+// connection serving the request, i.e., with QUICCorrelationConnection.
+// The ones associated with the request by IP address may belong to other
+// clients behind the same NAT, unless QUICIPCorrelation is set.
+type Matcher struct {
+	// HexIDs matches the HexID of the TLS ClientHello.
+	HexIDs []string `json:"hex_id,omitempty"`
+
+	// NormHexIDs matches the NormHexID of the TLS ClientHello, which does
+	// not depend on the extension order.
+	NormHexIDs []string `json:"norm_hex_id,omitempty"`
+
+	// QUICHexIDs matches the HexID of the QUIC fingerprint.
+	QUICHexIDs []string `json:"quic_hex_id,omitempty"`
+
+	// ALPN matches if the TLS ClientHello offers any of the protocols.
+	ALPN []string `json:"alpn,omitempty"`
+
+	// CipherSuites matches if the TLS ClientHello offers any of the cipher
+	// suites, given in decimal or in hexadecimal with the 0x prefix.
+	CipherSuites []string `json:"cipher_suite,omitempty"`
+
+	// FingerprintFile is the path to a file listing fingerprints, one per
+	// line, matching the HexID or NormHexID of the TLS ClientHello or the
+	// HexID of the QUIC fingerprint. Empty lines and lines starting with #
+	// are ignored.
+	FingerprintFile string `json:"fingerprint_file,omitempty"`
+
+	// QUICIPCorrelation also matches the QUIC fingerprints associated with
+	// the request by IP address, e.g., for HTTP/2 requests of clients which
+	// also connected over QUIC.
+	QUICIPCorrelation bool `json:"quic_ip_correlation,omitempty"`
+
+	cipherSuites []uint16
+	fingerprints map[string]bool
+
+	logger    *zap.Logger
+	reservoir fingerprintLookup
+}
+
+// fingerprintLookup looks up the fingerprints of the client of a request,
+// implemented by *app.Reservoir.
+type fingerprintLookup interface {
+	LookupClientHello(req *http.Request) *clienthellod.ClientHello
+	LookupQUICFingerprint(req *http.Request) *clienthellod.QUICFingerprint
+}
+
+// CaddyModule returns the Caddy module information.
+func (Matcher) CaddyModule() caddy.ModuleInfo { // skipcq: GO-W1029
+	return caddy.ModuleInfo{
+		ID:  "http.matchers.clienthellod",
+		New: func() caddy.Module { return new(Matcher) },
+	}
+}
+
+// Provision implements caddy.Provisioner.
+func (m *Matcher) Provision(ctx caddy.Context) error { // skipcq: GO-W1029
+	m.logger = ctx.Logger(m)
+
+	for _, cs := range m.CipherSuites {
+		v, err := strconv.ParseUint(cs, 0, 16)
+		if err != nil {
+			return fmt.Errorf("clienthellod matcher: invalid cipher_suite %s: %w", cs, err)
+		}
+		m.cipherSuites = append(m.cipherSuites, uint16(v))
+	}
+
+	if m.FingerprintFile != "" {
+		var err error
+		if m.fingerprints, err = loadFingerprints(m.FingerprintFile); err != nil {
+			return fmt.Errorf("clienthellod matcher: %w", err)
+		}
+		m.logger.Info("clienthellod matcher fingerprints loaded.", zap.String("file", m.FingerprintFile), zap.Int("count", len(m.fingerprints)))
+	}
+
+	if m.reservoir == nil {
+		a, err := ctx.AppIfConfigured(app.CaddyAppID)
+		if err != nil {
+			return err
+		}
+		m.reservoir = a.(*app.Reservoir)
+	}
+
+	return nil
+}
+
+// Validate implements caddy.Validator.
+func (m *Matcher) Validate() error { // skipcq: GO-W1029
+	if len(m.HexIDs) == 0 && len(m.NormHexIDs) == 0 && len(m.QUICHexIDs) == 0 &&
+		len(m.ALPN) == 0 && len(m.CipherSuites) == 0 && m.FingerprintFile == "" {
+		return errors.New("clienthellod matcher: at least one option must be set")
+	}
+	return nil
+}
+
+// Match implements caddyhttp.RequestMatcher.
+func (m *Matcher) Match(req *http.Request) bool { // skipcq: GO-W1029
+	// The QUIC fingerprint is looked up at most once, as it also carries
+	// the TLS ClientHello of HTTP/3 requests.
+	var qfp *clienthellod.QUICFingerprint
+	if len(m.QUICHexIDs) > 0 || m.FingerprintFile != "" || (req.ProtoMajor == 3 && m.needsClientHello()) {
+		qfp = m.lookupQUICFingerprint(req)
+	}
+	var ch *clienthellod.ClientHello
+	if m.needsClientHello() || m.FingerprintFile != "" {
+		ch = m.lookupClientHello(req, qfp)
+	}
+
+	if m.needsClientHello() && ch == nil {
+		m.logger.Debug(fmt.Sprintf("No TLS ClientHello to match for %s", req.RemoteAddr))
+		return false
+	}
+	if len(m.QUICHexIDs) > 0 && qfp == nil {
+		m.logger.Debug(fmt.Sprintf("No QUIC fingerprint to match for %s", req.RemoteAddr))
+		return false
+	}
+
+	if len(m.HexIDs) > 0 && !containsFold(m.HexIDs, ch.HexID) {
+		return false
+	}
+	if len(m.NormHexIDs) > 0 && !containsFold(m.NormHexIDs, ch.NormHexID) {
+		return false
+	}
+	if len(m.QUICHexIDs) > 0 && !containsFold(m.QUICHexIDs, qfp.HexID) {
+		return false
+	}
+	if len(m.ALPN) > 0 && !slices.ContainsFunc(ch.ALPN, func(proto string) bool { return slices.Contains(m.ALPN, proto) }) {
+		return false
+	}
+	if len(m.cipherSuites) > 0 && !slices.ContainsFunc(ch.CipherSuites, func(cs uint16) bool { return slices.Contains(m.cipherSuites, cs) }) {
+		return false
+	}
+	if m.FingerprintFile != "" && !m.matchFingerprints(ch, qfp) {
+		return false
+	}
+	return true
+}
+
+// needsClientHello tells if any option set is matched against the TLS
+// ClientHello.
+func (m *Matcher) needsClientHello() bool { // skipcq: GO-W1029
+	return len(m.HexIDs) > 0 || len(m.NormHexIDs) > 0 || len(m.ALPN) > 0 || len(m.CipherSuites) > 0
+}
+
+// lookupClientHello returns the TLS ClientHello of the request, or nil if
+// none is found. For HTTP/3 requests, it is the one of qfp, the QUIC
+// fingerprint returned by lookupQUICFingerprint.
+func (m *Matcher) lookupClientHello(req *http.Request, qfp *clienthellod.QUICFingerprint) *clienthellod.ClientHello { // skipcq: GO-W1029
+	if req.ProtoMajor <= 2 {
+		return m.reservoir.LookupClientHello(req)
+	}
+
+	if qfp == nil || qfp.ClientInitials == nil || qfp.ClientInitials.ClientHello == nil {
+		return nil
+	}
+	return &qfp.ClientInitials.ClientHello.ClientHello
+}
+
+// lookupQUICFingerprint returns the QUIC fingerprint of the request, or nil
+// if none is found or if it is only associated with the request by IP
+// address and QUICIPCorrelation is not set.
+func (m *Matcher) lookupQUICFingerprint(req *http.Request) *clienthellod.QUICFingerprint { // skipcq: GO-W1029
+	qfp := m.reservoir.LookupQUICFingerprint(req)
+	if qfp == nil || (qfp.Correlation != clienthellod.QUICCorrelationConnection && !m.QUICIPCorrelation) {
+		return nil
+	}
+	return qfp
+}
+
+// matchFingerprints tells if any fingerprint of the client, either of which
+// may be nil, is listed in the fingerprint file.
+func (m *Matcher) matchFingerprints(ch *clienthellod.ClientHello, qfp *clienthellod.QUICFingerprint) bool { // skipcq: GO-W1029
+	if ch != nil && (m.fingerprints[ch.HexID] || m.fingerprints[ch.NormHexID]) {
+		return true
+	}
+	return qfp != nil && m.fingerprints[qfp.HexID]
+}
+
+// loadFingerprints reads the fingerprints listed in a file, lowercased.
+func loadFingerprints(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fingerprint file: %w", err)
+	}
+	defer f.Close()
+
+	fingerprints := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fingerprints[strings.ToLower(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read fingerprint file: %w", err)
+	}
+	return fingerprints, nil
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(v, s) })
+}
+
+/*
+UnmarshalCaddyfile unmarshals Caddyfile tokens into m.
+
+Caddyfile syntax:
+
+	@bots clienthellod {
+		hex_id <hex_ids...>
+		norm_hex_id <hex_ids...>
+		quic_hex_id <hex_ids...>
+		alpn <protocols...>
+		cipher_suite <cipher_suites...>
+		fingerprint_file <path>
+		quic_ip_correlation
+	}
+*/
+func (m *Matcher) UnmarshalCaddyfile(d *caddyfile.Dispenser) error { // skipcq: GO-W1029
+	for d.Next() {
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for d.NextBlock(0) {
+			opt := d.Val()
+			args := d.RemainingArgs()
+			if opt == "quic_ip_correlation" {
+				if len(args) > 0 {
+					return d.ArgErr()
+				}
+				m.QUICIPCorrelation = true
+				continue
+			}
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			switch opt {
+			case "hex_id":
+				m.HexIDs = append(m.HexIDs, args...)
+			case "norm_hex_id":
+				m.NormHexIDs = append(m.NormHexIDs, args...)
+			case "quic_hex_id":
+				m.QUICHexIDs = append(m.QUICHexIDs, args...)
+			case "alpn":
+				m.ALPN = append(m.ALPN, args...)
+			case "cipher_suite":
+				m.CipherSuites = append(m.CipherSuites, args...)
+			case "fingerprint_file":
+				if m.FingerprintFile != "" {
+					return d.Err("clienthellod: only one fingerprint_file is allowed")
+				}
+				if len(args) > 1 {
+					return d.Err("too many arguments")
+				}
+				m.FingerprintFile = args[0]
+			default:
+				return d.Errf("clienthellod: unknown matcher option %s", opt)
+			}
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner        = (*Matcher)(nil)
+	_ caddy.Validator          = (*Matcher)(nil)
+	_ caddyhttp.RequestMatcher = (*Matcher)(nil)
+	_ caddyfile.Unmarshaler    = (*Matcher)(nil)
+)
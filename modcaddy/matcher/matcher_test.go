@@ -0,0 +1,203 @@
+package matcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/refraction-networking/clienthellod"
+)
+
+// stubReservoir returns fixed fingerprints and counts the QUIC lookups.
+type stubReservoir struct {
+	ch          *clienthellod.ClientHello
+	qfp         *clienthellod.QUICFingerprint
+	quicLookups int
+}
+
+func (r *stubReservoir) LookupClientHello(*http.Request) *clienthellod.ClientHello {
+	return r.ch
+}
+
+func (r *stubReservoir) LookupQUICFingerprint(*http.Request) *clienthellod.QUICFingerprint {
+	r.quicLookups++
+	return r.qfp
+}
+
+// provision provisions m with the stub reservoir instead of the clienthellod
+// app.
+func provision(t *testing.T, m *Matcher, r *stubReservoir) {
+	t.Helper()
+	m.reservoir = r
+	if err := m.Provision(caddy.Context{Context: context.Background()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	var m Matcher
+	err := m.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`clienthellod {
+		hex_id aa bb
+		hex_id cc
+		norm_hex_id dd
+		quic_hex_id ee
+		alpn h2 http/1.1
+		cipher_suite 0x1301 4865
+		fingerprint_file /etc/caddy/bots.txt
+		quic_ip_correlation
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Matcher{
+		HexIDs:            []string{"aa", "bb", "cc"},
+		NormHexIDs:        []string{"dd"},
+		QUICHexIDs:        []string{"ee"},
+		ALPN:              []string{"h2", "http/1.1"},
+		CipherSuites:      []string{"0x1301", "4865"},
+		FingerprintFile:   "/etc/caddy/bots.txt",
+		QUICIPCorrelation: true,
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("UnmarshalCaddyfile() = %+v, want %+v", m, want)
+	}
+}
+
+func TestUnmarshalCaddyfileErrors(t *testing.T) {
+	for name, input := range map[string]string{
+		"DuplicateFingerprintFile": "clienthellod {\n fingerprint_file a.txt\n fingerprint_file b.txt\n}",
+		"FingerprintFileArgs":      "clienthellod {\n fingerprint_file a.txt b.txt\n}",
+		"UnknownOption":            "clienthellod {\n ja3 abc\n}",
+		"MissingValue":             "clienthellod {\n hex_id\n}",
+		"QUICIPCorrelationArgs":    "clienthellod {\n quic_ip_correlation yes\n}",
+		"InlineArgs":               "clienthellod aa",
+	} {
+		t.Run(name, func(t *testing.T) {
+			var m Matcher
+			if err := m.UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err == nil {
+				t.Errorf("UnmarshalCaddyfile(%q) = nil, want an error", input)
+			}
+		})
+	}
+}
+
+func TestProvisionCipherSuite(t *testing.T) {
+	m := &Matcher{CipherSuites: []string{"0x1301", "4866"}}
+	provision(t, m, &stubReservoir{})
+	if want := []uint16{0x1301, 0x1302}; !reflect.DeepEqual(m.cipherSuites, want) {
+		t.Errorf("cipherSuites = %v, want %v", m.cipherSuites, want)
+	}
+
+	for _, cs := range []string{"tls_aes_128_gcm_sha256", "0x10000"} {
+		m := &Matcher{CipherSuites: []string{cs}, reservoir: &stubReservoir{}}
+		err := m.Provision(caddy.Context{Context: context.Background()})
+		if err == nil || !strings.Contains(err.Error(), "cipher_suite") {
+			t.Errorf("Provision() with cipher_suite %s = %v, want an invalid cipher_suite error", cs, err)
+		}
+	}
+}
+
+func TestProvisionFingerprintFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bots.txt")
+	content := "# known bots\n\nAABBCCDD\n  eeff0011  \n# 22334455\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Matcher{FingerprintFile: path}
+	provision(t, m, &stubReservoir{})
+	if want := map[string]bool{"aabbccdd": true, "eeff0011": true}; !reflect.DeepEqual(m.fingerprints, want) {
+		t.Errorf("fingerprints = %v, want %v", m.fingerprints, want)
+	}
+
+	m = &Matcher{FingerprintFile: filepath.Join(t.TempDir(), "missing.txt"), reservoir: &stubReservoir{}}
+	if err := m.Provision(caddy.Context{Context: context.Background()}); err == nil {
+		t.Error("Provision() with a missing fingerprint file = nil, want an error")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	ch := &clienthellod.ClientHello{
+		HexID:        "aabbccdd",
+		NormHexID:    "11223344",
+		ALPN:         []string{"h2", "http/1.1"},
+		CipherSuites: []uint16{0x1301, 0x1302},
+	}
+	qfp := &clienthellod.QUICFingerprint{
+		HexID:       "55667788",
+		Correlation: clienthellod.QUICCorrelationConnection,
+	}
+
+	for name, tc := range map[string]struct {
+		matcher Matcher
+		ch      *clienthellod.ClientHello
+		qfp     *clienthellod.QUICFingerprint
+		want    bool
+	}{
+		"HexID":                {Matcher{HexIDs: []string{"AABBCCDD"}}, ch, nil, true},
+		"HexIDAnyOf":           {Matcher{HexIDs: []string{"00000000", "aabbccdd"}}, ch, nil, true},
+		"HexIDNoneOf":          {Matcher{HexIDs: []string{"00000000"}}, ch, nil, false},
+		"NormHexID":            {Matcher{NormHexIDs: []string{"11223344"}}, ch, nil, true},
+		"ALPNAnyOf":            {Matcher{ALPN: []string{"h3", "h2"}}, ch, nil, true},
+		"ALPNNoneOf":           {Matcher{ALPN: []string{"h3"}}, ch, nil, false},
+		"CipherSuite":          {Matcher{CipherSuites: []string{"0x1302"}}, ch, nil, true},
+		"CipherSuiteNoneOf":    {Matcher{CipherSuites: []string{"0x1303"}}, ch, nil, false},
+		"AllOptions":           {Matcher{HexIDs: []string{"aabbccdd"}, ALPN: []string{"h2"}, QUICHexIDs: []string{"55667788"}}, ch, qfp, true},
+		"AllOptionsOneFails":   {Matcher{HexIDs: []string{"aabbccdd"}, ALPN: []string{"h3"}, QUICHexIDs: []string{"55667788"}}, ch, qfp, false},
+		"MissingClientHello":   {Matcher{ALPN: []string{"h2"}}, nil, qfp, false},
+		"MissingQUIC":          {Matcher{QUICHexIDs: []string{"55667788"}}, ch, nil, false},
+		"MissingQUICWithTLS":   {Matcher{HexIDs: []string{"aabbccdd"}, QUICHexIDs: []string{"55667788"}}, ch, nil, false},
+		"QUICHexID":            {Matcher{QUICHexIDs: []string{"55667788"}}, nil, qfp, true},
+		"QUICIPCorrelation":    {Matcher{QUICHexIDs: []string{"55667788"}}, nil, withCorrelation(qfp, clienthellod.QUICCorrelationIPUnique), false},
+		"QUICIPCorrelationOpt": {Matcher{QUICHexIDs: []string{"55667788"}, QUICIPCorrelation: true}, nil, withCorrelation(qfp, clienthellod.QUICCorrelationIPAmbiguous), true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := &stubReservoir{ch: tc.ch, qfp: tc.qfp}
+			m := tc.matcher
+			provision(t, &m, r)
+
+			req := httptest.NewRequest("GET", "https://example.com/", nil)
+			if got := m.Match(req); got != tc.want {
+				t.Errorf("Match() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchFingerprintFile(t *testing.T) {
+	m := &Matcher{FingerprintFile: "bots.txt", QUICHexIDs: []string{"55667788"}}
+	r := &stubReservoir{
+		ch:  &clienthellod.ClientHello{HexID: "aabbccdd", NormHexID: "11223344"},
+		qfp: &clienthellod.QUICFingerprint{HexID: "55667788", Correlation: clienthellod.QUICCorrelationConnection},
+	}
+	m.reservoir = r
+	m.fingerprints = map[string]bool{"11223344": true}
+	m.logger = caddy.Context{Context: context.Background()}.Logger()
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	if !m.Match(req) {
+		t.Error("Match() = false, want true for a NormHexID listed in the fingerprint file")
+	}
+	if r.quicLookups != 1 {
+		t.Errorf("Match() looked up the QUIC fingerprint %d times, want 1", r.quicLookups)
+	}
+
+	m.fingerprints = map[string]bool{"00000000": true}
+	if m.Match(req) {
+		t.Error("Match() = true, want false for fingerprints not listed in the fingerprint file")
+	}
+}
+
+func withCorrelation(qfp *clienthellod.QUICFingerprint, correlation clienthellod.QUICCorrelation) *clienthellod.QUICFingerprint {
+	c := *qfp
+	c.Correlation = correlation
+	return &c
+}
@@ -4,4 +4,5 @@ import (
 	_ "github.com/refraction-networking/clienthellod/modcaddy/app"
 	_ "github.com/refraction-networking/clienthellod/modcaddy/handler"
 	_ "github.com/refraction-networking/clienthellod/modcaddy/listener"
+	_ "github.com/refraction-networking/clienthellod/modcaddy/matcher"
 )
@@ -0,0 +1,360 @@
+// Package pcap fingerprints TLS and QUIC clients from packet captures in
+// pcap or pcapng format, without any live network listener.
+//
+// TLS ClientHellos are reassembled from the client-to-server direction of
+// TCP streams, tolerating out-of-order and retransmitted segments, and QUIC
+// Initial packets are grouped per connection by their Destination Connection
+// ID, the same way the conformance runner does.
+package pcap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/refraction-networking/clienthellod"
+)
+
+var pcapngMagic = []byte{0x0A, 0x0D, 0x0D, 0x0A}
+
+// flowIdleTimeout is the capture time after which a TCP stream or a QUIC
+// connection without any packet is forgotten, so the memory used by a Reader
+// does not grow with the size of the capture.
+const flowIdleTimeout = 2 * time.Minute
+
+// gatherDeadline is the wall clock deadline of the gathering of QUIC Initial
+// packets, which never passes: the Reader runs on capture time and expires
+// idle QUIC connections itself after flowIdleTimeout.
+var gatherDeadline = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// FiveTuple identifies the flow a fingerprint was extracted from, in the
+// client-to-server direction.
+type FiveTuple struct {
+	Network string `json:"network"` // "tcp" or "udp"
+	SrcIP   net.IP `json:"src_ip"`
+	SrcPort uint16 `json:"src_port"`
+	DstIP   net.IP `json:"dst_ip"`
+	DstPort uint16 `json:"dst_port"`
+}
+
+// String returns the 5-tuple as "network src -> dst".
+func (ft FiveTuple) String() string {
+	return fmt.Sprintf("%s %s -> %s", ft.Network,
+		net.JoinHostPort(ft.SrcIP.String(), fmt.Sprint(ft.SrcPort)),
+		net.JoinHostPort(ft.DstIP.String(), fmt.Sprint(ft.DstPort)))
+}
+
+// Result is a fingerprint extracted from a capture. Exactly one of
+// ClientHello and QUICFingerprint is set.
+type Result struct {
+	// Timestamp is the capture time of the first packet of the ClientHello
+	// (TCP) or of the first Initial packet of the connection (QUIC).
+	Timestamp time.Time `json:"timestamp"`
+	FiveTuple FiveTuple `json:"five_tuple"`
+
+	ClientHello     *clienthellod.ClientHello     `json:"client_hello,omitempty"`     // TLS over TCP
+	QUICFingerprint *clienthellod.QUICFingerprint `json:"quic_fingerprint,omitempty"` // QUIC
+
+	// DCID is the Destination Connection ID chosen by the client in its first
+	// Initial packet, hex-encoded. Only set for QUIC.
+	DCID string `json:"dcid,omitempty"`
+}
+
+// Reader reads fingerprints from a pcap or pcapng capture.
+//
+// Results are returned in the order they are completed, i.e., a QUIC
+// connection is returned when its ClientHello is complete, which may be
+// after packets of later connections.
+type Reader struct {
+	src    *gopacket.PacketSource
+	closer io.Closer
+
+	reassembler *clienthellod.TCPReassembler
+	tcpStreams  map[string]*tcpStream // keyed by 5-tuple
+	quicConns   map[string]*quicConn  // keyed by DCID
+	lastExpiry  time.Time
+}
+
+type tcpStream struct {
+	firstSeen time.Time // of the first segment carrying data
+	lastSeen  time.Time
+	done      bool // ClientHello extracted or not a TLS stream
+}
+
+type quicConn struct {
+	firstSeen time.Time
+	lastSeen  time.Time
+	fiveTuple FiveTuple
+	gci       *clienthellod.GatheredClientInitials
+	done      bool
+}
+
+// NewReader creates a Reader from a pcap or pcapng stream, detected by its
+// magic number.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture magic: %w", err)
+	}
+
+	var src *gopacket.PacketSource
+	if bytes.Equal(magic, pcapngMagic) {
+		ng, err := pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pcapng: %w", err)
+		}
+		src = gopacket.NewPacketSource(ng, ng.LinkType())
+	} else {
+		pr, err := pcapgo.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pcap: %w", err)
+		}
+		src = gopacket.NewPacketSource(pr, pr.LinkType())
+	}
+	src.DecodeOptions = gopacket.DecodeOptions{Lazy: true, NoCopy: true}
+
+	return &Reader{
+		src:         src,
+		reassembler: clienthellod.NewTCPReassembler(0), // capture time is not wall time, expired by the Reader
+		tcpStreams:  make(map[string]*tcpStream),
+		quicConns:   make(map[string]*quicConn),
+	}, nil
+}
+
+// Open opens a pcap or pcapng file. The returned Reader must be closed.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+// Close closes the underlying file if the Reader was created by [Open].
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// Next returns the next fingerprint in the capture. It returns io.EOF when
+// the capture is exhausted. Incomplete QUIC connections are not returned.
+func (r *Reader) Next() (*Result, error) {
+	for {
+		pkt, err := r.src.NextPacket()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("failed to read packet: %w", err)
+		}
+
+		r.expire(pkt.Metadata().Timestamp)
+
+		var res *Result
+		switch transport := pkt.TransportLayer().(type) {
+		case *layers.TCP:
+			res = r.handleTCP(pkt, transport)
+		case *layers.UDP:
+			res = r.handleUDP(pkt, transport)
+		}
+		if res != nil {
+			return res, nil
+		}
+	}
+}
+
+// ReadAll reads all remaining fingerprints in the capture.
+func (r *Reader) ReadAll() ([]*Result, error) {
+	var results []*Result
+	for {
+		res, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return results, nil
+			}
+			return results, err
+		}
+		results = append(results, res)
+	}
+}
+
+// Len returns the number of TCP streams and QUIC connections tracked,
+// including the handled ones not yet forgotten.
+func (r *Reader) Len() int {
+	return len(r.tcpStreams) + len(r.quicConns)
+}
+
+// expire forgets the TCP streams and QUIC connections idle for
+// flowIdleTimeout of capture time. Flows are swept at most once per
+// flowIdleTimeout.
+func (r *Reader) expire(now time.Time) {
+	if now.Sub(r.lastExpiry) < flowIdleTimeout {
+		return
+	}
+	r.lastExpiry = now
+
+	for key, stream := range r.tcpStreams {
+		if now.Sub(stream.lastSeen) > flowIdleTimeout {
+			r.forgetTCP(key)
+		}
+	}
+	for key, conn := range r.quicConns {
+		if now.Sub(conn.lastSeen) > flowIdleTimeout {
+			delete(r.quicConns, key)
+		}
+	}
+}
+
+func (r *Reader) forgetTCP(key string) {
+	delete(r.tcpStreams, key)
+	r.reassembler.Delete(key)
+}
+
+func (r *Reader) handleTCP(pkt gopacket.Packet, tcp *layers.TCP) *Result {
+	network := pkt.NetworkLayer()
+	if network == nil {
+		return nil
+	}
+	fiveTuple := newFiveTuple("tcp", network, uint16(tcp.SrcPort), uint16(tcp.DstPort))
+	key := fiveTuple.String()
+
+	if tcp.FIN || tcp.RST {
+		defer r.forgetTCP(key) // the connection is closed, the 5-tuple may be reused
+	}
+	stream := r.tcpStreams[key]
+	if stream == nil {
+		if !tcp.SYN && len(tcp.Payload) == 0 {
+			return nil
+		}
+		stream = &tcpStream{}
+		r.tcpStreams[key] = stream
+	}
+	stream.lastSeen = pkt.Metadata().Timestamp
+	if stream.done {
+		return nil
+	}
+	if stream.firstSeen.IsZero() && len(tcp.Payload) > 0 {
+		stream.firstSeen = stream.lastSeen
+	}
+
+	// Out-of-order and retransmitted segments are handled by the reassembler
+	ch, err := r.reassembler.AddSegment(key, tcp.Seq, tcp.SYN, tcp.Payload)
+	if errors.Is(err, clienthellod.ErrNeedMoreSegments) {
+		return nil
+	}
+	stream.done = true
+	r.reassembler.Delete(key) // nothing more is needed from the segments
+	if err != nil {
+		return nil // not a TLS stream
+	}
+
+	return &Result{
+		Timestamp:   stream.firstSeen,
+		FiveTuple:   fiveTuple,
+		ClientHello: ch,
+	}
+}
+
+func (r *Reader) handleUDP(pkt gopacket.Packet, udp *layers.UDP) *Result {
+	network := pkt.NetworkLayer()
+	if network == nil || len(udp.Payload) == 0 {
+		return nil
+	}
+
+	packets, err := clienthellod.UnmarshalQUICDatagram(udp.Payload)
+	if err != nil {
+		return nil // no decryptable QUIC v1/v2 client Initial
+	}
+	var dcid []byte
+	var initials []*clienthellod.ClientInitial
+	for _, cp := range packets {
+		if cp.Initial == nil {
+			continue
+		}
+		if dcid == nil {
+			dcid = quicDCID(cp.Raw())
+		}
+		initials = append(initials, cp.Initial)
+	}
+	if dcid == nil {
+		return nil
+	}
+
+	key := hex.EncodeToString(dcid)
+	conn := r.quicConns[key]
+	if conn == nil {
+		conn = &quicConn{
+			firstSeen: pkt.Metadata().Timestamp,
+			fiveTuple: newFiveTuple("udp", network, uint16(udp.SrcPort), uint16(udp.DstPort)),
+			gci:       clienthellod.GatherClientInitialsWithDeadline(gatherDeadline),
+		}
+		r.quicConns[key] = conn
+	}
+	conn.lastSeen = pkt.Metadata().Timestamp
+	if conn.done {
+		return nil
+	}
+
+	for _, cip := range initials {
+		_ = conn.gci.AddPacket(cip) // accept/dedup/reassembly logic lives in clienthellod
+	}
+	if !conn.gci.Completed() {
+		return nil
+	}
+	conn.done = true
+
+	qfp, err := clienthellod.GenerateQUICFingerprint(conn.gci)
+	if err != nil {
+		return nil
+	}
+	conn.gci = nil
+
+	return &Result{
+		Timestamp:       conn.firstSeen,
+		FiveTuple:       conn.fiveTuple,
+		QUICFingerprint: qfp,
+		DCID:            key,
+	}
+}
+
+func newFiveTuple(network string, nl gopacket.NetworkLayer, srcPort, dstPort uint16) FiveTuple {
+	ft := FiveTuple{Network: network, SrcPort: srcPort, DstPort: dstPort}
+	switch ip := nl.(type) {
+	case *layers.IPv4:
+		ft.SrcIP, ft.DstIP = append(net.IP{}, ip.SrcIP...), append(net.IP{}, ip.DstIP...)
+	case *layers.IPv6:
+		ft.SrcIP, ft.DstIP = append(net.IP{}, ip.SrcIP...), append(net.IP{}, ip.DstIP...)
+	}
+	return ft
+}
+
+// quicDCID extracts the DCID from a QUIC long header packet, or nil.
+func quicDCID(p []byte) []byte {
+	if len(p) < 6 || p[0]&0xC0 != 0xC0 {
+		return nil
+	}
+	dcidLen := int(p[5])
+	if 6+dcidLen > len(p) {
+		return nil
+	}
+	return append([]byte{}, p[6:6+dcidLen]...)
+}
@@ -0,0 +1,255 @@
+package pcap_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	. "github.com/refraction-networking/clienthellod/pcap"
+)
+
+var (
+	clientIP = net.IP{192, 0, 2, 1}
+	serverIP = net.IP{198, 51, 100, 1}
+)
+
+func mustReadTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("../internal/testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testCapture writes packets to a pcap or pcapng capture in memory.
+type testCapture struct {
+	t    *testing.T
+	buf  bytes.Buffer
+	ts   time.Time
+	pcap *pcapgo.Writer
+	ng   *pcapgo.NgWriter
+}
+
+func newTestCapture(t *testing.T, ng bool) *testCapture {
+	tc := &testCapture{t: t, ts: time.Unix(1700000000, 0).UTC()}
+	if ng {
+		w, err := pcapgo.NewNgWriter(&tc.buf, layers.LinkTypeEthernet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.ng = w
+	} else {
+		tc.pcap = pcapgo.NewWriter(&tc.buf)
+		if err := tc.pcap.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tc
+}
+
+func (tc *testCapture) write(transport gopacket.SerializableLayer, payload []byte) {
+	tc.t.Helper()
+
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: clientIP, DstIP: serverIP}
+	switch l := transport.(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		l.SetNetworkLayerForChecksum(ip)
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		l.SetNetworkLayerForChecksum(ip)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		&layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		},
+		ip, transport, gopacket.Payload(payload),
+	); err != nil {
+		tc.t.Fatal(err)
+	}
+
+	tc.ts = tc.ts.Add(time.Millisecond)
+	ci := gopacket.CaptureInfo{Timestamp: tc.ts, CaptureLength: len(buf.Bytes()), Length: len(buf.Bytes())}
+	var err error
+	if tc.ng != nil {
+		err = tc.ng.WritePacket(ci, buf.Bytes())
+	} else {
+		err = tc.pcap.WritePacket(ci, buf.Bytes())
+	}
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+func (tc *testCapture) bytes() []byte {
+	if tc.ng != nil {
+		if err := tc.ng.Flush(); err != nil {
+			tc.t.Fatal(err)
+		}
+	}
+	return tc.buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	for name, ng := range map[string]bool{"pcap": false, "pcapng": true} {
+		t.Run(name, func(t *testing.T) {
+			testReader(t, ng)
+		})
+	}
+}
+
+func testReader(t *testing.T, ng bool) {
+	tlsCH := mustReadTestdata(t, "TLS_ClientHello_Firefox_126.bin")
+	quicPKN1 := mustReadTestdata(t, "QUIC_IETF_Chrome_125_PKN1.bin")
+	quicPKN2 := mustReadTestdata(t, "QUIC_IETF_Chrome_125_PKN2.bin")
+
+	tc := newTestCapture(t, ng)
+
+	// QUIC Initials interleaved with a ClientHello split in two TCP segments,
+	// the first segment being retransmitted.
+	tc.write(&layers.UDP{SrcPort: 50000, DstPort: 443}, quicPKN1)
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: 1000, ACK: true, PSH: true}, tlsCH[:100])
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: 1000, ACK: true, PSH: true}, tlsCH[:100])
+	tc.write(&layers.TCP{SrcPort: 40001, DstPort: 443, Seq: 1, ACK: true, PSH: true}, []byte("GET / HTTP/1.1\r\n\r\n"))
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: 1100, ACK: true, PSH: true}, tlsCH[100:])
+	tc.write(&layers.UDP{SrcPort: 50000, DstPort: 443}, quicPKN2)
+
+	r, err := NewReader(bytes.NewReader(tc.bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	results, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	tlsRes, quicRes := results[0], results[1]
+
+	if tlsRes.ClientHello == nil || tlsRes.QUICFingerprint != nil {
+		t.Fatalf("first result must be a TLS ClientHello, got %+v", tlsRes)
+	}
+	if tlsRes.ClientHello.JA4() != "t13d1715h2_5b57614c22b0_5c2c66f702b0" {
+		t.Errorf("ClientHello.JA4() = %s", tlsRes.ClientHello.JA4())
+	}
+	if tlsRes.FiveTuple.String() != "tcp 192.0.2.1:40000 -> 198.51.100.1:443" {
+		t.Errorf("FiveTuple = %s", tlsRes.FiveTuple)
+	}
+	if want := time.Unix(1700000000, 0).Add(2 * time.Millisecond); !tlsRes.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %s, want %s", tlsRes.Timestamp, want)
+	}
+
+	if quicRes.QUICFingerprint == nil || quicRes.ClientHello != nil {
+		t.Fatalf("second result must be a QUIC fingerprint, got %+v", quicRes)
+	}
+	if quicRes.QUICFingerprint.JA4 != "q13d0311h3_55b375c5d22e_5a1f323ef56d" {
+		t.Errorf("QUICFingerprint.JA4 = %s", quicRes.QUICFingerprint.JA4)
+	}
+	if quicRes.FiveTuple.String() != "udp 192.0.2.1:50000 -> 198.51.100.1:443" {
+		t.Errorf("FiveTuple = %s", quicRes.FiveTuple)
+	}
+	if want := time.Unix(1700000000, 0).Add(time.Millisecond); !quicRes.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %s, want %s", quicRes.Timestamp, want)
+	}
+	if quicRes.DCID == "" {
+		t.Error("DCID is empty")
+	}
+
+	if _, err = r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Next() after ReadAll = %v, want io.EOF", err)
+	}
+}
+
+func TestReaderTCPOutOfOrder(t *testing.T) {
+	tlsCH := mustReadTestdata(t, "TLS_ClientHello_Firefox_126.bin")
+
+	tc := newTestCapture(t, false)
+
+	// SYN followed by a ClientHello in three segments, the last one first,
+	// with sequence numbers wrapping around.
+	isn := uint32(0xfffffff0)
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: isn, SYN: true}, nil)
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: isn + 1 + 400, ACK: true, PSH: true}, tlsCH[400:])
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: isn + 1 + 200, ACK: true}, tlsCH[200:400])
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: isn + 1, ACK: true}, tlsCH[:200])
+
+	r, err := NewReader(bytes.NewReader(tc.bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	results, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ClientHello == nil {
+		t.Fatalf("got %+v, want a single ClientHello", results)
+	}
+	if !bytes.Equal(results[0].ClientHello.Raw(), tlsCH) {
+		t.Error("reassembled ClientHello does not match")
+	}
+	if want := time.Unix(1700000000, 0).Add(2 * time.Millisecond); !results[0].Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %s, want %s", results[0].Timestamp, want)
+	}
+}
+
+func TestReaderForgetsFlows(t *testing.T) {
+	tlsCH := mustReadTestdata(t, "TLS_ClientHello_Firefox_126.bin")
+	quicPKN1 := mustReadTestdata(t, "QUIC_IETF_Chrome_125_PKN1.bin")
+	quicPKN2 := mustReadTestdata(t, "QUIC_IETF_Chrome_125_PKN2.bin")
+
+	tc := newTestCapture(t, false)
+
+	// The source port is reused by a second connection once the first one
+	// is closed.
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: 1000, ACK: true, PSH: true}, tlsCH)
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: 1000 + uint32(len(tlsCH)), ACK: true, FIN: true}, nil)
+	tc.write(&layers.TCP{SrcPort: 40000, DstPort: 443, Seq: 5000, ACK: true, PSH: true}, tlsCH)
+	tc.write(&layers.UDP{SrcPort: 50000, DstPort: 443}, quicPKN1)
+	tc.write(&layers.UDP{SrcPort: 50000, DstPort: 443}, quicPKN2)
+
+	// Flows idle for long enough are forgotten.
+	tc.ts = tc.ts.Add(3 * time.Minute)
+	tc.write(&layers.TCP{SrcPort: 40001, DstPort: 443, Seq: 1, ACK: true, PSH: true}, []byte("GET / HTTP/1.1\r\n\r\n"))
+
+	r, err := NewReader(bytes.NewReader(tc.bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	results, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if r.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", r.Len())
+	}
+}
+
+func TestNewReaderInvalid(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture file"))); err == nil {
+		t.Error("expected error for invalid capture")
+	}
+}
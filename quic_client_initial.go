@@ -16,11 +16,19 @@ type ClientInitial struct {
 	FrameTypes []uint64    `json:"frames,omitempty"` // frames ID in order
 	frames     QUICFrames  // frames in order
 	raw        []byte
+
+	// Coalesced lists the types of all QUIC packets in the UDP datagram
+	// carrying this Initial packet, in order, including this packet itself.
+	// Only set by UnmarshalQUICDatagram.
+	Coalesced []QUICPacketType `json:"coalesced,omitempty"`
 }
 
 // UnmarshalQUICClientInitialPacket is similar to ParseQUICCIP, but on error
 // such as ClientHello cannot be parsed, it returns a partially completed
 // ClientInitialPacket instead of nil.
+//
+// Only the first packet of p is decoded. Use [UnmarshalQUICDatagram] to
+// decode every Initial packet coalesced in a UDP datagram.
 func UnmarshalQUICClientInitialPacket(p []byte) (ci *ClientInitial, err error) {
 	ci = &ClientInitial{
 		raw: p,
@@ -39,6 +47,7 @@ func UnmarshalQUICClientInitialPacket(p []byte) (ci *ClientInitial, err error) {
 		c.FrameTypes = nil
 		c.frames = nil
 		c.raw = nil
+		c.Coalesced = nil
 	})
 
 	return ci, nil
@@ -63,6 +72,8 @@ type GatheredClientInitials struct {
 	completed             atomic.Bool
 	completeChan          chan struct{}
 	completeChanCloseOnce sync.Once
+
+	expiryToken uint64 // set when saved by QUICFingerprinter
 }
 
 const (
@@ -31,6 +31,8 @@ func ParseQUICClientHello(p []byte) (*QUICClientHello, error) {
 		return nil, err
 	}
 
+	ch.TLSRecordLengths = nil // the TLS record is not on the wire
+
 	if ch.qtp == nil {
 		return nil, ErrNotQUICInitialPacket
 	}
@@ -46,3 +48,28 @@ func ParseQUICClientHello(p []byte) (*QUICClientHello, error) {
 func (qch *QUICClientHello) Raw() []byte {
 	return qch.ClientHello.Raw()[5:] // strip TLS record header which is added by ParseQUICClientHello
 }
+
+// JA4 returns the JA4 fingerprint of the QUIC ClientHello, which uses
+// the protocol prefix "q" instead of "t".
+func (qch *QUICClientHello) JA4() string {
+	return qch.ja4(ja4ProtocolQUIC, false, false)
+}
+
+// JA4R returns the raw (unhashed) form of the JA4 fingerprint of the
+// QUIC ClientHello, a.k.a. JA4_r.
+func (qch *QUICClientHello) JA4R() string {
+	return qch.ja4(ja4ProtocolQUIC, false, true)
+}
+
+// JA4O returns the JA4 fingerprint of the QUIC ClientHello computed with
+// cipher suites and extensions in their original order, a.k.a. JA4_o.
+func (qch *QUICClientHello) JA4O() string {
+	return qch.ja4(ja4ProtocolQUIC, true, false)
+}
+
+// JA4RO returns the raw (unhashed) form of the JA4 fingerprint of the QUIC
+// ClientHello computed with cipher suites and extensions in their original
+// order, a.k.a. JA4_ro.
+func (qch *QUICClientHello) JA4RO() string {
+	return qch.ja4(ja4ProtocolQUIC, true, true)
+}
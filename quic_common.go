@@ -10,10 +10,22 @@ import (
 	"golang.org/x/crypto/cryptobyte"
 )
 
-// QUICVersion1 is the QUIC v1 version number (RFC 9000). It is the only version
-// clienthellod can decrypt: ClientInitialKeysCalc derives Initial keys with the
-// v1 salt (RFC 9001).
-const QUICVersion1 uint32 = 0x00000001
+const (
+	// QUICVersion1 is the QUIC v1 version number (RFC 9000).
+	QUICVersion1 uint32 = 0x00000001
+
+	// QUICVersion2 is the QUIC v2 version number (RFC 9369). It differs from
+	// v1 in the long header packet type bits, the Initial salt and the HKDF
+	// labels used to derive Initial keys.
+	QUICVersion2 uint32 = 0x6b3343cf
+)
+
+// IsSupportedQUICVersion returns true if clienthellod can decrypt Initial
+// packets of the given QUIC version.
+func IsSupportedQUICVersion(version uint32) bool {
+	_, ok := quicInitialParamsByVersion[version]
+	return ok
+}
 
 // ReadNextVLI unpacks the next variable-length integer from the given
 // io.Reader. It returns the decoded value and the number of bytes read.
@@ -89,7 +101,7 @@ func IsGREASETransportParameter(paramType uint64) bool {
 var (
 	ErrNotQUICLongHeaderFormat = errors.New("not a QUIC Long Header Format Packet")
 	ErrNotQUICInitialPacket    = errors.New("not a QUIC Initial Packet")
-	ErrUnsupportedQUICVersion  = errors.New("unsupported QUIC version (only v1 is supported)")
+	ErrUnsupportedQUICVersion  = errors.New("unsupported QUIC version (only v1 and v2 are supported)")
 )
 
 // DecodeQUICHeaderAndFrames decodes a QUIC initial packet and returns a QUICHeader.
@@ -113,27 +125,28 @@ func DecodeQUICHeaderAndFrames(p []byte) (hdr *QUICHeader, frames QUICFrames, er
 		return nil, nil, ErrNotQUICLongHeaderFormat
 	}
 
-	// check if it's a QUIC Initial Packet: MSB lower 2 bits are 0
-	if packetHeaderByteProtected&0x30 != 0 {
-		return nil, nil, ErrNotQUICInitialPacket
-	}
-
-	// LSB of the first byte is protected, we will resolve it later
-
 	hdr.Version = make(utils.Uint8Arr, 4)
 	copy(hdr.Version, p[1:5])
-
-	// Only QUIC v1 is supported (ClientInitialKeysCalc uses the v1 salt). Reject
-	// any other version BEFORE deriving keys. This matters for GREASE-version
-	// probes: quiche sends an Initial with a reserved version (e.g. 0xbabababa)
-	// reusing the real connection's DCID. Decrypting it with v1 keys yields
-	// garbage CRYPTO that, grouped under the same DCID, collides with the real
-	// v1 Initial and breaks ClientHello reconstruction — so no fingerprint is
-	// produced at all. Skipping it here lets the real Initial be fingerprinted.
-	if binary.BigEndian.Uint32(hdr.Version) != QUICVersion1 {
+	version := binary.BigEndian.Uint32(hdr.Version)
+
+	// Only QUIC v1 and v2 are supported. Reject any other version BEFORE
+	// deriving keys. This matters for GREASE-version probes: quiche sends an
+	// Initial with a reserved version (e.g. 0xbabababa) reusing the real
+	// connection's DCID. Decrypting it with v1 keys yields garbage CRYPTO that,
+	// grouped under the same DCID, collides with the real Initial and breaks
+	// ClientHello reconstruction — so no fingerprint is produced at all.
+	// Skipping it here lets the real Initial be fingerprinted.
+	if !IsSupportedQUICVersion(version) {
 		return nil, nil, ErrUnsupportedQUICVersion
 	}
 
+	// check if it's a QUIC Initial Packet, the packet type bits are version-specific
+	if quicLongHeaderPacketType(packetHeaderByteProtected, version) != QUICPacketType_Initial {
+		return nil, nil, ErrNotQUICInitialPacket
+	}
+
+	// LSB of the first byte is protected, we will resolve it later
+
 	s := cryptobyte.String(p[5:])
 	initialRandom := new(cryptobyte.String)
 	if !s.ReadUint8LengthPrefixed(initialRandom) {
@@ -187,7 +200,7 @@ func DecodeQUICHeaderAndFrames(p []byte) (hdr *QUICHeader, frames QUICFrames, er
 	}
 
 	// do key calculation
-	clientKey, clientIV, clientHpKey, err := ClientInitialKeysCalc(*initialRandom)
+	clientKey, clientIV, clientHpKey, err := ClientInitialKeysCalcWithVersion(version, *initialRandom)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -10,31 +10,68 @@ import (
 	"golang.org/x/crypto/hkdf"
 )
 
-// ClientInitialKeysCalc calculates the client key, IV and header protection key from the initial random.
+// ClientInitialKeysCalc calculates the client key, IV and header protection key from the initial random
+// for QUIC version 1.
 func ClientInitialKeysCalc(initialRandom []byte) (clientKey, clientIV, clientHpKey []byte, err error) {
-	initialSalt := []byte{
-		0x38, 0x76, 0x2c, 0xf7,
-		0xf5, 0x59, 0x34, 0xb3,
-		0x4d, 0x17, 0x9a, 0xe6,
-		0xa4, 0xc8, 0x0c, 0xad,
-		0xcc, 0xbb, 0x7f, 0x0a,
-	} // magic value, the first SHA-1 collision
+	return ClientInitialKeysCalcWithVersion(QUICVersion1, initialRandom)
+}
+
+// quicInitialParams holds the version-specific parameters used to derive the Initial keys.
+type quicInitialParams struct {
+	salt                       []byte
+	keyLabel, ivLabel, hpLabel string
+}
+
+var quicInitialParamsByVersion = map[uint32]quicInitialParams{
+	QUICVersion1: { // RFC 9001, Section 5.2
+		salt: []byte{
+			0x38, 0x76, 0x2c, 0xf7,
+			0xf5, 0x59, 0x34, 0xb3,
+			0x4d, 0x17, 0x9a, 0xe6,
+			0xa4, 0xc8, 0x0c, 0xad,
+			0xcc, 0xbb, 0x7f, 0x0a,
+		}, // magic value, the first SHA-1 collision
+		keyLabel: "quic key",
+		ivLabel:  "quic iv",
+		hpLabel:  "quic hp",
+	},
+	QUICVersion2: { // RFC 9369, Section 3.3.1 and 3.3.2
+		salt: []byte{
+			0x0d, 0xed, 0xe3, 0xde,
+			0xf7, 0x00, 0xa6, 0xdb,
+			0x81, 0x93, 0x81, 0xbe,
+			0x6e, 0x26, 0x9d, 0xcb,
+			0xf9, 0xbd, 0x2e, 0xd9,
+		},
+		keyLabel: "quicv2 key",
+		ivLabel:  "quicv2 iv",
+		hpLabel:  "quicv2 hp",
+	},
+}
+
+// ClientInitialKeysCalcWithVersion calculates the client key, IV and header protection key from the
+// initial random for the given QUIC version. Only QUIC v1 and v2 are supported.
+func ClientInitialKeysCalcWithVersion(version uint32, initialRandom []byte) (clientKey, clientIV, clientHpKey []byte, err error) {
+	params, ok := quicInitialParamsByVersion[version]
+	if !ok {
+		return nil, nil, nil, ErrUnsupportedQUICVersion
+	}
 
-	initialSecret := hkdf.Extract(sha256.New, initialRandom, initialSalt)
+	initialSecret := hkdf.Extract(sha256.New, initialRandom, params.salt)
 
 	clientSecret, err := hkdfExpandLabel(initialSecret, "client in", nil, 32)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	clientKey, err = hkdfExpandLabel(clientSecret, "quic key", nil, 16)
+	clientKey, err = hkdfExpandLabel(clientSecret, params.keyLabel, nil, 16)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	clientIV, err = hkdfExpandLabel(clientSecret, "quic iv", nil, 12)
+	clientIV, err = hkdfExpandLabel(clientSecret, params.ivLabel, nil, 12)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	clientHpKey, err = hkdfExpandLabel(clientSecret, "quic hp", nil, 16)
+	clientHpKey, err = hkdfExpandLabel(clientSecret, params.hpLabel, nil, 16)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -0,0 +1,221 @@
+package clienthellod
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// QUICPacketType is the type of a QUIC packet, independent of the
+// version-specific encoding of the long header packet type bits.
+type QUICPacketType uint8
+
+const (
+	QUICPacketType_Initial QUICPacketType = iota
+	QUICPacketType_0RTT
+	QUICPacketType_Handshake
+	QUICPacketType_Retry
+	QUICPacketType_VersionNegotiation
+	QUICPacketType_1RTT    // short header packet
+	QUICPacketType_Unknown // long header packet of an unsupported version
+)
+
+// String implements fmt.Stringer.
+func (t QUICPacketType) String() string {
+	switch t {
+	case QUICPacketType_Initial:
+		return "initial"
+	case QUICPacketType_0RTT:
+		return "0-rtt"
+	case QUICPacketType_Handshake:
+		return "handshake"
+	case QUICPacketType_Retry:
+		return "retry"
+	case QUICPacketType_VersionNegotiation:
+		return "version_negotiation"
+	case QUICPacketType_1RTT:
+		return "1-rtt"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler, so the packet type is
+// displayed as a string in JSON.
+func (t QUICPacketType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// quicLongHeaderPacketType decodes the long header packet type bits of the
+// first byte, which are version-specific (RFC 9000, Section 17.2 and
+// RFC 9369, Section 3.2).
+func quicLongHeaderPacketType(firstByte byte, version uint32) QUICPacketType {
+	bits := (firstByte & 0x30) >> 4
+	switch version {
+	case QUICVersion1:
+		return [4]QUICPacketType{
+			QUICPacketType_Initial,
+			QUICPacketType_0RTT,
+			QUICPacketType_Handshake,
+			QUICPacketType_Retry,
+		}[bits]
+	case QUICVersion2:
+		return [4]QUICPacketType{
+			QUICPacketType_Retry,
+			QUICPacketType_Initial,
+			QUICPacketType_0RTT,
+			QUICPacketType_Handshake,
+		}[bits]
+	default:
+		return QUICPacketType_Unknown
+	}
+}
+
+// CoalescedPacket is one of the QUIC packets carried in a single UDP datagram.
+type CoalescedPacket struct {
+	Type    QUICPacketType `json:"type"`
+	Version uint32         `json:"version,omitempty"` // 0 for short header packets
+	Offset  int            `json:"offset"`            // offset of the packet in the datagram
+	Length  int            `json:"length"`            // length of the packet including its header
+
+	Initial *ClientInitial `json:"initial,omitempty"` // decoded Initial packet, only set by UnmarshalQUICDatagram
+	Err     error          `json:"-"`                 // error decoding the Initial packet, only set by UnmarshalQUICDatagram
+
+	raw []byte
+}
+
+// Raw returns the raw bytes of the packet.
+func (cp *CoalescedPacket) Raw() []byte {
+	return cp.raw
+}
+
+// SplitQUICDatagram walks all QUIC packets coalesced in a UDP datagram
+// (RFC 9000, Section 12.2) and returns them in order. Packets are not decrypted.
+//
+// A packet without a Length field (short header, Retry, Version Negotiation
+// or long header of an unsupported version) extends to the end of the datagram.
+// Trailing zero bytes after the last packet are treated as padding and ignored.
+//
+// On error, the packets found before the malformed one are returned along with
+// the error.
+func SplitQUICDatagram(p []byte) (packets []*CoalescedPacket, err error) {
+	for off := 0; off < len(p); {
+		b := p[off:]
+		if b[0] == 0x00 {
+			break // padding, some clients pad the datagram with zeros after the last packet
+		}
+
+		cp := &CoalescedPacket{Offset: off}
+		packets = append(packets, cp)
+
+		if b[0]&0x80 == 0 { // short header, always the last packet in a datagram
+			cp.Type = QUICPacketType_1RTT
+			cp.Length, cp.raw = len(b), b
+			break
+		}
+
+		if len(b) < 7 {
+			return packets, errors.New("long header packet too short")
+		}
+		cp.Version = binary.BigEndian.Uint32(b[1:5])
+
+		var hasLength bool
+		switch {
+		case cp.Version == 0:
+			cp.Type = QUICPacketType_VersionNegotiation
+		case !IsSupportedQUICVersion(cp.Version):
+			cp.Type = QUICPacketType_Unknown
+		default:
+			cp.Type = quicLongHeaderPacketType(b[0], cp.Version)
+			hasLength = cp.Type != QUICPacketType_Retry
+		}
+		if !hasLength {
+			cp.Length, cp.raw = len(b), b
+			break
+		}
+
+		var dcid, scid cryptobyte.String
+		s := cryptobyte.String(b[5:])
+		if !s.ReadUint8LengthPrefixed(&dcid) || !s.ReadUint8LengthPrefixed(&scid) {
+			return packets, errors.New("failed to read connection IDs")
+		}
+
+		r := bytes.NewReader(s)
+		if cp.Type == QUICPacketType_Initial {
+			tokenLen, _, err := ReadNextVLI(r)
+			if err != nil {
+				return packets, fmt.Errorf("failed to read token length: %w", err)
+			}
+			if _, err = r.Seek(int64(tokenLen), io.SeekCurrent); err != nil || r.Len() == 0 {
+				return packets, errors.New("failed to skip token")
+			}
+		}
+
+		length, _, err := ReadNextVLI(r)
+		if err != nil {
+			return packets, fmt.Errorf("failed to read packet length: %w", err)
+		}
+		if length > uint64(r.Len()) {
+			return packets, errors.New("packet length exceeds datagram")
+		}
+
+		cp.Length = len(b) - r.Len() + int(length)
+		cp.raw = b[:cp.Length]
+		off += cp.Length
+	}
+
+	return packets, nil
+}
+
+// UnmarshalQUICDatagram splits a UDP datagram into its coalesced QUIC packets
+// with [SplitQUICDatagram] and decodes every Initial packet among them. The
+// decoded Initial packets record the types of all packets in the datagram in
+// [ClientInitial.Coalesced].
+//
+// An Initial packet failing to decode, e.g., one which cannot be decrypted,
+// does not prevent the other Initial packets from being decoded. Its error is
+// set in [CoalescedPacket.Err] instead. Likewise, a malformed packet only
+// stops the walk through the datagram, and the packets found before it are
+// returned. An error is returned only if no Initial packet at all could be
+// decoded.
+func UnmarshalQUICDatagram(p []byte) ([]*CoalescedPacket, error) {
+	var errs []error
+	packets, err := SplitQUICDatagram(p)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	types := CoalescedPacketTypes(packets)
+
+	var decoded bool
+	for _, cp := range packets {
+		if cp.Type != QUICPacketType_Initial {
+			continue
+		}
+		ci, err := UnmarshalQUICClientInitialPacket(cp.raw)
+		if err != nil {
+			cp.Err = err
+			errs = append(errs, fmt.Errorf("failed to decode Initial packet at offset %d: %w", cp.Offset, err))
+			continue
+		}
+		ci.Coalesced = types
+		cp.Initial, decoded = ci, true
+	}
+	if !decoded && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return packets, nil
+}
+
+// CoalescedPacketTypes returns the types of the given packets in order.
+func CoalescedPacketTypes(packets []*CoalescedPacket) []QUICPacketType {
+	types := make([]QUICPacketType, 0, len(packets))
+	for _, cp := range packets {
+		types = append(types, cp.Type)
+	}
+	return types
+}
@@ -0,0 +1,140 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+func TestSplitQUICDatagram(t *testing.T) {
+	for name, tc := range map[string]struct {
+		datagram []byte
+		types    []QUICPacketType
+		offsets  []int
+		lengths  []int
+	}{
+		"Chrome125_PKN1": {
+			datagram: quicIETFData_Chrome125_PKN1,
+			types:    []QUICPacketType{QUICPacketType_Initial},
+			offsets:  []int{0},
+			lengths:  []int{len(quicIETFData_Chrome125_PKN1)},
+		},
+		"Firefox126": {
+			datagram: quicIETFData_Firefox126,
+			types:    []QUICPacketType{QUICPacketType_Initial},
+			offsets:  []int{0},
+			lengths:  []int{675},
+		},
+		"Firefox126_0-RTT": {
+			datagram: quicIETFData_Firefox126_0_RTT,
+			types:    []QUICPacketType{QUICPacketType_Initial, QUICPacketType_0RTT},
+			offsets:  []int{0, 724},
+			lengths:  []int{724, 401},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			packets, err := SplitQUICDatagram(tc.datagram)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if types := CoalescedPacketTypes(packets); !reflect.DeepEqual(types, tc.types) {
+				t.Fatalf("types: got %v, want %v", types, tc.types)
+			}
+			for i, cp := range packets {
+				if cp.Offset != tc.offsets[i] || cp.Length != tc.lengths[i] {
+					t.Errorf("packet %d: got offset %d length %d, want offset %d length %d",
+						i, cp.Offset, cp.Length, tc.offsets[i], tc.lengths[i])
+				}
+				if cp.Version != QUICVersion1 {
+					t.Errorf("packet %d: got version %#x, want %#x", i, cp.Version, QUICVersion1)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitQUICDatagramShortHeader(t *testing.T) {
+	datagram := append(append([]byte{}, quicIETFData_Firefox126_0_RTT[:724]...), 0x40, 0x01, 0x02, 0x03)
+
+	packets, err := SplitQUICDatagram(datagram)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []QUICPacketType{QUICPacketType_Initial, QUICPacketType_1RTT}
+	if types := CoalescedPacketTypes(packets); !reflect.DeepEqual(types, want) {
+		t.Fatalf("types: got %v, want %v", types, want)
+	}
+	if packets[1].Length != 4 {
+		t.Errorf("short header packet length: got %d, want 4", packets[1].Length)
+	}
+}
+
+func TestSplitQUICDatagramTruncated(t *testing.T) {
+	packets, err := SplitQUICDatagram(quicIETFData_Firefox126_0_RTT[:1000])
+	if err == nil {
+		t.Fatal("expected error for truncated 0-RTT packet")
+	}
+	if len(packets) != 2 || packets[0].Type != QUICPacketType_Initial || packets[0].Length != 724 {
+		t.Fatalf("expected the Initial packet to be returned before the error, got %v", CoalescedPacketTypes(packets))
+	}
+}
+
+func TestUnmarshalQUICDatagram(t *testing.T) {
+	packets, err := UnmarshalQUICDatagram(quicIETFData_Firefox126_0_RTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(packets) != 2 {
+		t.Fatalf("expected 2 packets, got %d", len(packets))
+	}
+	if packets[0].Initial == nil {
+		t.Fatal("Initial packet is not decoded")
+	}
+	if packets[1].Initial != nil {
+		t.Error("0-RTT packet must not be decoded as Initial")
+	}
+
+	want := []QUICPacketType{QUICPacketType_Initial, QUICPacketType_0RTT}
+	if !reflect.DeepEqual(packets[0].Initial.Coalesced, want) {
+		t.Errorf("ClientInitial.Coalesced: got %v, want %v", packets[0].Initial.Coalesced, want)
+	}
+}
+
+func TestUnmarshalQUICDatagramTruncated(t *testing.T) {
+	packets, err := UnmarshalQUICDatagram(quicIETFData_Firefox126_0_RTT[:1000])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 2 || packets[0].Initial == nil {
+		t.Fatal("Initial packet before a malformed packet is not decoded")
+	}
+}
+
+func TestUnmarshalQUICDatagramUndecryptable(t *testing.T) {
+	initial := quicIETFData_Firefox126_0_RTT[:724]
+	corrupted := bytes.Clone(initial)
+	corrupted[len(corrupted)-1] ^= 0xff // breaks the AEAD tag
+
+	packets, err := UnmarshalQUICDatagram(append(bytes.Clone(corrupted), initial...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 2 {
+		t.Fatalf("expected 2 packets, got %d", len(packets))
+	}
+	if packets[0].Initial != nil || packets[0].Err == nil {
+		t.Error("undecryptable Initial packet must be reported in Err")
+	}
+	if packets[1].Initial == nil || packets[1].Err != nil {
+		t.Errorf("Initial packet coalesced after an undecryptable one is not decoded: %v", packets[1].Err)
+	}
+
+	if _, err = UnmarshalQUICDatagram(corrupted); err == nil {
+		t.Error("expected an error when no Initial packet can be decoded")
+	}
+}
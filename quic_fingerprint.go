@@ -21,9 +21,45 @@ type QUICFingerprint struct {
 	HexID string `json:"hex_id,omitempty"`
 	NumID uint64 `json:"num_id,omitempty"`
 
+	JA4  string `json:"ja4,omitempty"`   // JA4 fingerprint of the QUIC ClientHello ("q" prefix)
+	JA4O string `json:"ja4_o,omitempty"` // JA4_o fingerprint of the QUIC ClientHello, original order
+
+	// CoalescedPacketTypes lists, for each gathered Initial packet in packet
+	// number order, the QUIC packet types coalesced in the datagram carrying
+	// it, e.g., [[initial, 0-rtt], [initial]].
+	//
+	// It is informational only and not part of HexID or NumID, as it depends
+	// on the state of the client, e.g., whether it resumes a session with
+	// 0-RTT data, rather than on its implementation.
+	CoalescedPacketTypes [][]QUICPacketType `json:"coalesced_packet_types,omitempty"`
+
 	UserAgent string `json:"user_agent,omitempty"` // User-Agent header, set by the caller
+
+	// Correlation tells how confidently the fingerprint is associated with
+	// the request it is served for, set by the caller.
+	Correlation QUICCorrelation `json:"correlation,omitempty"`
 }
 
+// QUICCorrelation tells how a QUICFingerprint is associated with a request,
+// e.g., an HTTP request served over another connection than the QUIC one.
+type QUICCorrelation string
+
+const (
+	// QUICCorrelationConnection is set when the fingerprint comes from the
+	// QUIC connection carrying the request.
+	QUICCorrelationConnection QUICCorrelation = "connection"
+
+	// QUICCorrelationIPUnique is set when the fingerprint comes from another
+	// connection of the same IP address, which sent no other fingerprint.
+	QUICCorrelationIPUnique QUICCorrelation = "ip_unique"
+
+	// QUICCorrelationIPAmbiguous is set when the fingerprint comes from
+	// another connection of the same IP address, which sent different
+	// fingerprints, e.g., several clients behind a NAT. The most recent
+	// fingerprint is used.
+	QUICCorrelationIPAmbiguous QUICCorrelation = "ip_ambiguous"
+)
+
 // GenerateQUICFingerprint generates a QUICFingerprint from the gathered ClientInitials.
 func GenerateQUICFingerprint(gci *GatheredClientInitials) (*QUICFingerprint, error) {
 	if err := gci.Wait(); err != nil {
@@ -44,6 +80,15 @@ func GenerateQUICFingerprint(gci *GatheredClientInitials) (*QUICFingerprint, err
 	qfp.NumID = binary.BigEndian.Uint64(h.Sum(nil))
 	qfp.HexID = FingerprintID(qfp.NumID).AsHex()
 
+	qfp.JA4 = gci.ClientHello.JA4()
+	qfp.JA4O = gci.ClientHello.JA4O()
+
+	for _, ci := range gci.Packets {
+		if ci.Coalesced != nil {
+			qfp.CoalescedPacketTypes = append(qfp.CoalescedPacketTypes, ci.Coalesced)
+		}
+	}
+
 	runtime.SetFinalizer(qfp, func(q *QUICFingerprint) {
 		q.ClientInitials = nil
 	})
@@ -55,7 +100,8 @@ const DEFAULT_QUICFINGERPRINT_EXPIRY = 60 * time.Second
 
 // QUICFingerprinter can be used to fingerprint QUIC connections.
 type QUICFingerprinter struct {
-	mapGatheringClientInitials *sync.Map
+	mapGatheringClientInitials FingerprintStore
+	janitor                    *utils.Janitor
 
 	timeout time.Duration
 	closed  atomic.Bool
@@ -63,17 +109,22 @@ type QUICFingerprinter struct {
 
 // NewQUICFingerprinter creates a new QUICFingerprinter.
 func NewQUICFingerprinter() *QUICFingerprinter {
-	return &QUICFingerprinter{
-		mapGatheringClientInitials: new(sync.Map),
-		closed:                     atomic.Bool{},
-	}
+	return NewQUICFingerprinterWithStore(new(sync.Map))
 }
 
 // NewQUICFingerprinterWithTimeout creates a new QUICFingerprinter with a timeout.
 func NewQUICFingerprinterWithTimeout(timeout time.Duration) *QUICFingerprinter {
+	qfp := NewQUICFingerprinterWithStore(new(sync.Map))
+	qfp.timeout = timeout
+	return qfp
+}
+
+// NewQUICFingerprinterWithStore creates a new QUICFingerprinter saving
+// GatheredClientInitials to the given store, e.g., a bounded [LRUStore].
+func NewQUICFingerprinterWithStore(store FingerprintStore) *QUICFingerprinter {
 	return &QUICFingerprinter{
-		mapGatheringClientInitials: new(sync.Map),
-		timeout:                    timeout,
+		mapGatheringClientInitials: store,
+		janitor:                    newStoreJanitor(store),
 		closed:                     atomic.Bool{},
 	}
 }
@@ -83,20 +134,26 @@ func (qfp *QUICFingerprinter) SetTimeout(timeout time.Duration) {
 	qfp.timeout = timeout
 }
 
-// HandlePacket handles a QUIC packet.
+// HandlePacket handles a UDP datagram, gathering every QUIC Initial packet
+// coalesced in it.
 func (qfp *QUICFingerprinter) HandlePacket(from string, p []byte) error {
 	if qfp.closed.Load() {
 		return errors.New("QUICFingerprinter closed")
 	}
 
-	ci, err := UnmarshalQUICClientInitialPacket(p)
+	packets, err := UnmarshalQUICDatagram(p)
 	if err != nil {
-		if errors.Is(err, ErrNotQUICLongHeaderFormat) || errors.Is(err, ErrNotQUICInitialPacket) ||
-			errors.Is(err, ErrUnsupportedQUICVersion) {
-			return nil // totally fine, we don't care about non-QUIC-v1 initials
-		}
 		return err
 	}
+	var initials []*ClientInitial
+	for _, cp := range packets {
+		if cp.Initial != nil {
+			initials = append(initials, cp.Initial)
+		}
+	}
+	if len(initials) == 0 {
+		return nil // totally fine, we don't care about non-Initial or unsupported-version packets
+	}
 
 	var testGci *GatheredClientInitials
 	if qfp.timeout == time.Duration(0) {
@@ -104,28 +161,30 @@ func (qfp *QUICFingerprinter) HandlePacket(from string, p []byte) error {
 	} else {
 		testGci = GatherClientInitialsWithDeadline(time.Now().Add(qfp.timeout))
 	}
+	testGci.expiryToken = lastExpiryToken.Add(1)
 
 	chosenGci, existing := qfp.mapGatheringClientInitials.LoadOrStore(from, testGci)
 	if !existing {
 		// if we stored the testGci, we need to delete it after the timeout
-		funcExpiringAfter := func(d time.Duration) {
-			<-time.After(d)
-			qfp.mapGatheringClientInitials.Delete(from)
-		}
-
 		if qfp.timeout == time.Duration(0) {
-			go funcExpiringAfter(DEFAULT_QUICFINGERPRINT_EXPIRY)
+			qfp.janitor.Schedule(DEFAULT_QUICFINGERPRINT_EXPIRY, storeExpiry{from, testGci.expiryToken}, nil)
 		} else {
-			go funcExpiringAfter(qfp.timeout)
+			qfp.janitor.Schedule(qfp.timeout, storeExpiry{from, testGci.expiryToken}, nil)
 		}
 	}
 
 	gci, ok := chosenGci.(*GatheredClientInitials)
 	if !ok {
-		return errors.New("GatheredClientInitials loaded from sync.Map failed type assertion")
+		return errors.New("GatheredClientInitials loaded from store failed type assertion")
 	}
 
-	return gci.AddPacket(ci)
+	var errs []error
+	for _, ci := range initials {
+		if err := gci.AddPacket(ci); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // HandleUDPConn handles a QUIC connection over UDP.
@@ -213,7 +272,7 @@ func (qfp *QUICFingerprinter) PeekAwait(from string) (*QUICFingerprint, error) {
 
 	gatheredCI, ok := gci.(*GatheredClientInitials)
 	if !ok {
-		return nil, errors.New("GatheredClientInitials loaded from sync.Map failed type assertion")
+		return nil, errors.New("GatheredClientInitials loaded from store failed type assertion")
 	}
 
 	qf, err := GenerateQUICFingerprint(gatheredCI)
@@ -231,6 +290,7 @@ func (qfp *QUICFingerprinter) Pop(from string) *QUICFingerprint {
 	if !ok {
 		return nil
 	}
+	qfp.janitor.Cancel(storeExpiry{from, expiryToken(gci)})
 
 	gatheredCI, ok := gci.(*GatheredClientInitials)
 	if !ok {
@@ -259,10 +319,11 @@ func (qfp *QUICFingerprinter) PopAwait(from string) (*QUICFingerprint, error) {
 	if !ok {
 		return nil, errors.New("GatheredClientInitials not found for the given key")
 	}
+	qfp.janitor.Cancel(storeExpiry{from, expiryToken(gci)})
 
 	gatheredCI, ok := gci.(*GatheredClientInitials)
 	if !ok {
-		return nil, errors.New("GatheredClientInitials loaded from sync.Map failed type assertion")
+		return nil, errors.New("GatheredClientInitials loaded from store failed type assertion")
 	}
 
 	qf, err := GenerateQUICFingerprint(gatheredCI)
@@ -273,7 +334,9 @@ func (qfp *QUICFingerprinter) PopAwait(from string) (*QUICFingerprint, error) {
 	return qf, nil
 }
 
-// Close closes the QUICFingerprinter.
+// Close closes the QUICFingerprinter and stops expiring the saved
+// GatheredClientInitials.
 func (qfp *QUICFingerprinter) Close() {
 	qfp.closed.Store(true)
+	qfp.janitor.Close()
 }
@@ -0,0 +1,87 @@
+package clienthellod_test
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+func TestGenerateQUICFingerprint(t *testing.T) {
+	gci := GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+	for _, d := range mapGatheredClientInitials["Chrome125"] {
+		cip, err := UnmarshalQUICClientInitialPacket(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = gci.AddPacket(cip); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	qfp, err := GenerateQUICFingerprint(gci)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if qfp.JA4 != "q13d0311h3_55b375c5d22e_5a1f323ef56d" {
+		t.Errorf("JA4 = %s, want q13d0311h3_55b375c5d22e_5a1f323ef56d", qfp.JA4)
+	}
+	if qfp.JA4O != "q13d0311h3_55b375c5d22e_054a4567f333" {
+		t.Errorf("JA4_o = %s, want q13d0311h3_55b375c5d22e_054a4567f333", qfp.JA4O)
+	}
+
+	// the embedded ClientHello still reports the TCP form
+	if ja4 := gci.ClientHello.ClientHello.JA4(); !strings.HasPrefix(ja4, "t13d0311h3_") {
+		t.Errorf("ClientHello.JA4 = %s, want prefix t13d0311h3_", ja4)
+	}
+}
+
+func TestQUICFingerprinterHandlePacketCoalesced(t *testing.T) {
+	qfpr := NewQUICFingerprinterWithTimeout(time.Minute)
+	defer qfpr.Close()
+
+	// Both Initial packets of Chrome coalesced in a single datagram
+	datagram := append(append([]byte{}, quicIETFData_Chrome125_PKN1...), quicIETFData_Chrome125_PKN2...)
+	if err := qfpr.HandlePacket("192.0.2.1:50000", datagram); err != nil {
+		t.Fatal(err)
+	}
+
+	qfp := qfpr.Peek("192.0.2.1:50000")
+	if qfp == nil {
+		t.Fatal("QUIC fingerprint is incomplete, the second coalesced Initial packet is dropped")
+	}
+	if qfp.JA4 != "q13d0311h3_55b375c5d22e_5a1f323ef56d" {
+		t.Errorf("JA4 = %s, want q13d0311h3_55b375c5d22e_5a1f323ef56d", qfp.JA4)
+	}
+	coalesced := []QUICPacketType{QUICPacketType_Initial, QUICPacketType_Initial}
+	if want := [][]QUICPacketType{coalesced, coalesced}; !reflect.DeepEqual(qfp.CoalescedPacketTypes, want) {
+		t.Errorf("CoalescedPacketTypes = %v, want %v", qfp.CoalescedPacketTypes, want)
+	}
+}
+
+func BenchmarkQUICFingerprinterHandlePacket(b *testing.B) {
+	qfp := NewQUICFingerprinterWithTimeout(time.Minute)
+	defer qfp.Close()
+
+	goroutines := runtime.NumGoroutine()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		from := fmt.Sprintf("10.0.%d.%d:443", (i>>8)&0xff, i&0xff)
+		for _, p := range mapGatheredClientInitials["Chrome125"] {
+			if err := qfp.HandlePacket(from, p); err != nil {
+				b.Fatal(err)
+			}
+		}
+		qfp.Pop(from)
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(runtime.NumGoroutine()-goroutines), "goroutines")
+}
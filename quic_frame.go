@@ -9,9 +9,13 @@ import (
 )
 
 const (
-	QUICFrame_PADDING uint64 = 0 // 0
-	QUICFrame_PING    uint64 = 1 // 1
-	QUICFrame_CRYPTO  uint64 = 6 // 6
+	QUICFrame_PADDING              uint64 = 0    // 0
+	QUICFrame_PING                 uint64 = 1    // 1
+	QUICFrame_ACK                  uint64 = 2    // 2
+	QUICFrame_ACK_ECN              uint64 = 3    // 3
+	QUICFrame_CRYPTO               uint64 = 6    // 6
+	QUICFrame_CONNECTION_CLOSE     uint64 = 0x1c // 28
+	QUICFrame_CONNECTION_CLOSE_APP uint64 = 0x1d // 29
 )
 
 // QUICFrame is the interface that wraps the basic methods of a QUIC frame.
@@ -49,8 +53,17 @@ func ReadAllFrames(r io.Reader) ([]QUICFrame, error) {
 			frame = &PADDING{}
 		case QUICFrame_PING:
 			frame = &PING{}
+		case QUICFrame_ACK:
+			frame = &ACK{}
+		case QUICFrame_ACK_ECN:
+			frame = &ACK{ECN: true}
 		case QUICFrame_CRYPTO:
 			frame = &CRYPTO{}
+		case QUICFrame_CONNECTION_CLOSE:
+			frame = &CONNECTION_CLOSE{}
+		case QUICFrame_CONNECTION_CLOSE_APP:
+			// only the QUIC variant is allowed in Initial packets (RFC 9000, Section 12.4)
+			return nil, fmt.Errorf("frame type 0x%.2x not allowed in Initial packets", frameType)
 		default:
 			return nil, fmt.Errorf("unknown frame type: 0x%.2x", frameType)
 		}
@@ -173,6 +186,82 @@ func (*PING) ReadReader(r io.Reader) (rr io.Reader, err error) {
 	return r, nil
 }
 
+// ACK frame, with or without ECN counts
+type ACK struct {
+	ECN bool `json:"ecn,omitempty"` // true for frame type 0x03, which carries ECN counts
+
+	LargestAcknowledged uint64     `json:"largest_acknowledged"`
+	AckDelay            uint64     `json:"ack_delay"`
+	FirstAckRange       uint64     `json:"first_ack_range"`
+	AckRanges           []ACKRange `json:"ack_ranges,omitempty"` // additional ranges, in order
+
+	// ECN counts, only present if ECN is true
+	ECT0Count  uint64 `json:"ect0_count,omitempty"`
+	ECT1Count  uint64 `json:"ect1_count,omitempty"`
+	ECNCECount uint64 `json:"ecn_ce_count,omitempty"`
+}
+
+// ACKRange is an additional range of acknowledged packets in an ACK frame.
+type ACKRange struct {
+	Gap    uint64 `json:"gap"`
+	Length uint64 `json:"length"`
+}
+
+// FrameType implements QUICFrame interface.
+func (f *ACK) FrameType() uint64 {
+	if f.ECN {
+		return QUICFrame_ACK_ECN
+	}
+	return QUICFrame_ACK
+}
+
+// ReadReader implements QUICFrame interface. It reads the acknowledged
+// ranges and, for ACK frames of type 0x03, the ECN counts.
+func (f *ACK) ReadReader(r io.Reader) (rr io.Reader, err error) {
+	if f.LargestAcknowledged, _, err = ReadNextVLI(r); err != nil {
+		return r, err
+	}
+	if f.AckDelay, _, err = ReadNextVLI(r); err != nil {
+		return r, err
+	}
+
+	ackRangeCount, _, err := ReadNextVLI(r)
+	if err != nil {
+		return r, err
+	}
+
+	if f.FirstAckRange, _, err = ReadNextVLI(r); err != nil {
+		return r, err
+	}
+
+	// ackRangeCount is not trusted for preallocation, a truncated frame
+	// fails on the read below.
+	for i := uint64(0); i < ackRangeCount; i++ {
+		var ackRange ACKRange
+		if ackRange.Gap, _, err = ReadNextVLI(r); err != nil {
+			return r, err
+		}
+		if ackRange.Length, _, err = ReadNextVLI(r); err != nil {
+			return r, err
+		}
+		f.AckRanges = append(f.AckRanges, ackRange)
+	}
+
+	if f.ECN {
+		if f.ECT0Count, _, err = ReadNextVLI(r); err != nil {
+			return r, err
+		}
+		if f.ECT1Count, _, err = ReadNextVLI(r); err != nil {
+			return r, err
+		}
+		if f.ECNCECount, _, err = ReadNextVLI(r); err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
 // CRYPTO frame
 type CRYPTO struct {
 	Offset uint64 `json:"offset,omitempty"` // offset of crypto data, from VLI
@@ -212,6 +301,54 @@ func (f *CRYPTO) Data() []byte {
 	return append([]byte{}, f.data...)
 }
 
+// CONNECTION_CLOSE frame, signaling a QUIC (0x1c) error. The application
+// variant (0x1d) is not allowed in Initial packets and is rejected by
+// [ReadAllFrames].
+type CONNECTION_CLOSE struct {
+	ErrorCode          uint64 `json:"error_code"`
+	TriggerFrameType   uint64 `json:"frame_type,omitempty"`
+	ReasonPhraseLength uint64 `json:"reason_phrase_length,omitempty"`
+	reasonPhrase       []byte
+}
+
+// FrameType implements QUICFrame interface.
+func (f *CONNECTION_CLOSE) FrameType() uint64 {
+	return QUICFrame_CONNECTION_CLOSE
+}
+
+// ReadReader implements QUICFrame interface. It reads the error code, the
+// triggering frame type and the reason phrase.
+func (f *CONNECTION_CLOSE) ReadReader(r io.Reader) (rr io.Reader, err error) {
+	if f.ErrorCode, _, err = ReadNextVLI(r); err != nil {
+		return r, err
+	}
+
+	if f.TriggerFrameType, _, err = ReadNextVLI(r); err != nil {
+		return r, err
+	}
+
+	if f.ReasonPhraseLength, _, err = ReadNextVLI(r); err != nil {
+		return r, err
+	}
+
+	// The length is not trusted for allocation, read at most that many bytes
+	// and check that none are missing.
+	f.reasonPhrase, err = io.ReadAll(io.LimitReader(r, int64(f.ReasonPhraseLength)))
+	if err != nil {
+		return r, err
+	}
+	if uint64(len(f.reasonPhrase)) != f.ReasonPhraseLength {
+		return r, io.ErrUnexpectedEOF
+	}
+
+	return r, nil
+}
+
+// ReasonPhrase returns the reason phrase of the CONNECTION_CLOSE frame.
+func (f *CONNECTION_CLOSE) ReasonPhrase() string {
+	return string(f.reasonPhrase)
+}
+
 // This is an old name reserved for compatibility purpose, it is
 // equivalent to [QUICFrame].
 //
@@ -222,5 +359,7 @@ type Frame = QUICFrame
 var (
 	_ QUICFrame = (*PADDING)(nil)
 	_ QUICFrame = (*PING)(nil)
+	_ QUICFrame = (*ACK)(nil)
 	_ QUICFrame = (*CRYPTO)(nil)
+	_ QUICFrame = (*CONNECTION_CLOSE)(nil)
 )
@@ -89,6 +89,148 @@ func TestCRYPTO(t *testing.T) {
 	}
 }
 
+func TestACK(t *testing.T) {
+	var ackRaw []byte = []byte{
+		/* 0x03, */ // Frame Type, to be read by ReadAllFrames()
+		0x40, 0x10, // Largest Acknowledged: 16
+		0x44, 0x00, // ACK Delay: 1024
+		0x01,                    // ACK Range Count: 1
+		0x02,                    // First ACK Range: 2
+		0x03,                    // Gap: 3
+		0x04,                    // ACK Range Length: 4
+		0x05,                    // ECT0 Count: 5
+		0x00,                    // ECT1 Count: 0
+		0x01,                    // ECN-CE Count: 1
+		'h', 'e', 'l', 'l', 'o', // extra bytes shouldn't be read
+	}
+
+	var ack ACK = ACK{ECN: true}
+	if ack.FrameType() != QUICFrame_ACK_ECN {
+		t.Errorf("ack.FrameType() = %d, want %d", ack.FrameType(), QUICFrame_ACK_ECN)
+	}
+
+	r, err := ack.ReadReader(bytes.NewReader(ackRaw))
+	if err != nil {
+		t.Fatalf("ack.ReadReader() error = %v", err)
+	}
+
+	if ack.LargestAcknowledged != 16 || ack.AckDelay != 1024 || ack.FirstAckRange != 2 {
+		t.Errorf("ack = %+v, want LargestAcknowledged 16, AckDelay 1024, FirstAckRange 2", ack)
+	}
+	if len(ack.AckRanges) != 1 || ack.AckRanges[0] != (ACKRange{Gap: 3, Length: 4}) {
+		t.Errorf("ack.AckRanges = %v, want [{3 4}]", ack.AckRanges)
+	}
+	if ack.ECT0Count != 5 || ack.ECT1Count != 0 || ack.ECNCECount != 1 {
+		t.Errorf("ack ECN counts = %d, %d, %d, want 5, 0, 1", ack.ECT0Count, ack.ECT1Count, ack.ECNCECount)
+	}
+
+	// check what's left in the Reader
+	buf := make([]byte, 10)
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Errorf("ack.ReadReader() error = %v", err)
+	}
+
+	if n != 5 || string(buf[:n]) != "hello" {
+		t.Errorf("ack.ReadReader() = %d, %s, want 5, hello", n, string(buf[:n]))
+	}
+
+	// without ECN, the counts must not be consumed
+	var ackNoECN ACK
+	if ackNoECN.FrameType() != QUICFrame_ACK {
+		t.Errorf("ackNoECN.FrameType() = %d, want %d", ackNoECN.FrameType(), QUICFrame_ACK)
+	}
+	r, err = ackNoECN.ReadReader(bytes.NewReader(ackRaw))
+	if err != nil {
+		t.Fatalf("ackNoECN.ReadReader() error = %v", err)
+	}
+	n, _ = r.Read(buf)
+	if n != 8 || buf[0] != 0x05 {
+		t.Errorf("ackNoECN.ReadReader() left %d bytes starting with 0x%02x, want 8 bytes starting with 0x05", n, buf[0])
+	}
+
+	// truncated
+	if _, err = (&ACK{ECN: true}).ReadReader(bytes.NewReader(ackRaw[:8])); err == nil {
+		t.Errorf("ack.ReadReader() on truncated frame: expected error")
+	}
+}
+
+func TestCONNECTION_CLOSE(t *testing.T) {
+	var ccRaw []byte = []byte{
+		/* 0x1c, */ // Frame Type, to be read by ReadAllFrames()
+		0x0a,       // Error Code: PROTOCOL_VIOLATION
+		0x06,       // Frame Type: CRYPTO
+		0x03,       // Reason Phrase Length: 3
+		'b', 'a', 'd',
+		'h', 'e', 'l', 'l', 'o', // extra bytes shouldn't be read
+	}
+
+	var cc CONNECTION_CLOSE
+	if cc.FrameType() != QUICFrame_CONNECTION_CLOSE {
+		t.Errorf("cc.FrameType() = %d, want %d", cc.FrameType(), QUICFrame_CONNECTION_CLOSE)
+	}
+
+	r, err := cc.ReadReader(bytes.NewReader(ccRaw))
+	if err != nil {
+		t.Fatalf("cc.ReadReader() error = %v", err)
+	}
+
+	if cc.ErrorCode != 0x0a || cc.TriggerFrameType != QUICFrame_CRYPTO || cc.ReasonPhrase() != "bad" {
+		t.Errorf("cc = %+v, reason %q, want ErrorCode 0x0a, TriggerFrameType 0x06, reason \"bad\"", cc, cc.ReasonPhrase())
+	}
+
+	buf := make([]byte, 10)
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Errorf("cc.ReadReader() error = %v", err)
+	}
+	if n != 5 || string(buf[:n]) != "hello" {
+		t.Errorf("cc.ReadReader() = %d, %s, want 5, hello", n, string(buf[:n]))
+	}
+
+	// truncated reason phrase
+	if _, err = (&CONNECTION_CLOSE{}).ReadReader(bytes.NewReader([]byte{0x0a, 0x06, 0x40, 0xff, 'b'})); err == nil {
+		t.Errorf("cc.ReadReader() on truncated frame: expected error")
+	}
+}
+
+func TestReadAllFramesACKAndCONNECTION_CLOSE(t *testing.T) {
+	var raw []byte = []byte{
+		0x02, 0x00, 0x00, 0x00, 0x00, // ACK
+		0x06, 0x00, 0x02, 0xab, 0xcd, // CRYPTO
+		0x1c, 0x00, 0x00, 0x00, // CONNECTION_CLOSE
+		0x00, 0x00, 0x00, // PADDING
+	}
+
+	frames, err := ReadAllFrames(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frameTypesTruth []uint64 = []uint64{
+		QUICFrame_ACK, QUICFrame_CRYPTO, QUICFrame_CONNECTION_CLOSE, QUICFrame_PADDING,
+	}
+	if len(frames) != len(frameTypesTruth) {
+		t.Fatalf("len(frames) = %d, want %d", len(frames), len(frameTypesTruth))
+	}
+	for i, frame := range frames {
+		if frame.FrameType() != frameTypesTruth[i] {
+			t.Fatalf("frame#%d type mismatch: %d != %d", i, frame.FrameType(), frameTypesTruth[i])
+		}
+	}
+}
+
+func TestReadAllFramesCONNECTION_CLOSE_APP(t *testing.T) {
+	var raw []byte = []byte{
+		0x06, 0x00, 0x02, 0xab, 0xcd, // CRYPTO
+		0x1d, 0x00, 0x00, // CONNECTION_CLOSE (application)
+	}
+
+	if _, err := ReadAllFrames(bytes.NewReader(raw)); err == nil {
+		t.Fatal("ReadAllFrames() accepted an application CONNECTION_CLOSE frame, not allowed in Initial packets")
+	}
+}
+
 func TestReadAllFramesAndReassemble(t *testing.T) {
 	frames, err := ReadAllFrames(bytes.NewReader(allFramesRaw))
 	if err != nil {
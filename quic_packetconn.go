@@ -0,0 +1,67 @@
+package clienthellod
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync/atomic"
+)
+
+// QUICPacketConn is a net.PacketConn fingerprinting the QUIC Initial packets
+// read from it with a QUICFingerprinter, keyed by their source address. It
+// can be used as the connection of a QUIC server, e.g., a quic-go Transport,
+// to fingerprint its clients inline, without a raw socket.
+//
+// QUICPacketConn intentionally does not expose the underlying connection,
+// e.g., with an Unwrap method, as servers unwrapping it would read from the
+// underlying connection directly and bypass the fingerprinting. As a result,
+// quic-go does not use optimizations requiring a *net.UDPConn, such as GSO.
+type QUICPacketConn struct {
+	net.PacketConn
+	fingerprinter atomic.Pointer[QUICFingerprinter]
+}
+
+// NewQUICPacketConn wraps pc into a QUICPacketConn saving the fingerprints
+// to fingerprinter.
+func NewQUICPacketConn(pc net.PacketConn, fingerprinter *QUICFingerprinter) *QUICPacketConn {
+	c := &QUICPacketConn{
+		PacketConn: pc,
+	}
+	c.fingerprinter.Store(fingerprinter)
+	return c
+}
+
+// SetFingerprinter replaces the QUICFingerprinter the fingerprints are
+// saved to, e.g., when a server reloading its configuration keeps the
+// connection open.
+func (c *QUICPacketConn) SetFingerprinter(fingerprinter *QUICFingerprinter) {
+	c.fingerprinter.Store(fingerprinter)
+}
+
+// ReadFrom implements net.PacketConn.
+func (c *QUICPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil && n > 0 && p[0]&0x80 != 0 { // long header packet, possibly Initial
+		// p is reused by the caller, while the fingerprinter keeps the packet
+		_ = c.fingerprinter.Load().HandlePacket(addr.String(), bytes.Clone(p[:n]))
+	}
+	return n, addr, err
+}
+
+// SetReadBuffer sets the size of the receive buffer of the underlying
+// connection.
+func (c *QUICPacketConn) SetReadBuffer(size int) error {
+	if conn, ok := c.PacketConn.(interface{ SetReadBuffer(int) error }); ok {
+		return conn.SetReadBuffer(size)
+	}
+	return errors.New("SetReadBuffer not supported by the underlying connection")
+}
+
+// SetWriteBuffer sets the size of the send buffer of the underlying
+// connection.
+func (c *QUICPacketConn) SetWriteBuffer(size int) error {
+	if conn, ok := c.PacketConn.(interface{ SetWriteBuffer(int) error }); ok {
+		return conn.SetWriteBuffer(size)
+	}
+	return errors.New("SetWriteBuffer not supported by the underlying connection")
+}
@@ -0,0 +1,56 @@
+package clienthellod_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+func TestQUICPacketConn(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	qfp := NewQUICFingerprinterWithTimeout(time.Second)
+	defer qfp.Close()
+	pc := NewQUICPacketConn(server, qfp)
+	defer pc.Close()
+
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	packets := mapGatheredClientInitials["Chrome125"]
+	for _, p := range packets {
+		if _, err = client.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, 2048)
+	for i := range packets {
+		_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.String() != client.LocalAddr().String() || n != len(packets[i]) {
+			t.Fatalf("ReadFrom() = %d, %s, want %d, %s", n, addr, len(packets[i]), client.LocalAddr())
+		}
+		for j := range buf[:n] {
+			buf[j] = 0 // the buffer is reused by the caller
+		}
+	}
+
+	fp := qfp.Peek(client.LocalAddr().String())
+	if fp == nil {
+		t.Fatal("no QUIC fingerprint for the client")
+	}
+	if fp.JA4 != "q13d0311h3_55b375c5d22e_5a1f323ef56d" {
+		t.Errorf("JA4 = %s, want q13d0311h3_55b375c5d22e_5a1f323ef56d", fp.JA4)
+	}
+}
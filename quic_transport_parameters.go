@@ -2,6 +2,7 @@ package clienthellod
 
 import (
 	"bytes" // skipcq: GSC-G505
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"sort"
@@ -14,6 +15,10 @@ const (
 	QTP_GREASE = 27
 
 	UNSET_VLI_BITS = true // if false, unsetVLIBits() will be nop
+
+	// Widely-deployed transport parameters not (yet) in dicttls
+	QTP_version_information_draft uint64 = 0xff73db   // draft-ietf-quic-version-negotiation
+	QTP_min_ack_delay             uint64 = 0xff04de1b // draft-ietf-quic-ack-frequency
 )
 
 // QUICTransportParameters is a struct to hold the parsed QUIC transport parameters
@@ -31,14 +36,47 @@ type QUICTransportParameters struct {
 	MaxAckDelay                    utils.Uint8Arr `json:"max_ack_delay,omitempty"`
 
 	ActiveConnectionIDLimit utils.Uint8Arr `json:"active_connection_id_limit,omitempty"`
-	QTPIDs                  []uint64       `json:"tpids,omitempty"` // sorted
+	QTPIDs                  []uint64       `json:"tpids,omitempty"`          // sorted
+	QTPIDsOriginal          []uint64       `json:"tpids_original,omitempty"` // in original order
+
+	// Connection IDs are random, only their length is kept. nil if absent.
+	InitialSourceConnectionIDLength *int `json:"initial_source_connection_id_length,omitempty"`
+
+	DisableActiveMigration  bool                     `json:"disable_active_migration,omitempty"`
+	MaxDatagramFrameSize    utils.Uint8Arr           `json:"max_datagram_frame_size,omitempty"`
+	GreaseQUICBit           bool                     `json:"grease_quic_bit,omitempty"`
+	VersionInformation      *QUICVersionInformation  `json:"version_information,omitempty"` // from either 0x11 or 0xff73db
+	MinAckDelay             utils.Uint8Arr           `json:"min_ack_delay,omitempty"`
+	InitialRTT              utils.Uint8Arr           `json:"initial_rtt,omitempty"`
+	GoogleConnectionOptions []string                 `json:"google_connection_options,omitempty"`
+	UserAgent               string                   `json:"user_agent,omitempty"`
+	GoogleVersion           uint32                   `json:"google_version,omitempty"`
+	UnknownParameters       []QUICTransportParameter `json:"unknown_parameters,omitempty"` // non-GREASE parameters not decoded above
 
 	HexID string `json:"hex_id,omitempty"`
 	NumID uint64 `json:"num_id,omitempty"`
 
+	// Same as HexID and NumID, but computed over QTPIDsOriginal so that
+	// the parameter order is a part of the fingerprint.
+	OrderedHexID string `json:"ordered_hex_id,omitempty"`
+	OrderedNumID uint64 `json:"ordered_num_id,omitempty"`
+
 	parseError error
 }
 
+// QUICVersionInformation is the decoded version_information transport parameter
+// as defined in RFC 9368.
+type QUICVersionInformation struct {
+	ChosenVersion     uint32   `json:"chosen_version"`
+	AvailableVersions []uint32 `json:"available_versions,omitempty"`
+}
+
+// QUICTransportParameter is a raw transport parameter as an id/value pair.
+type QUICTransportParameter struct {
+	ID    uint64         `json:"id"`
+	Value utils.Uint8Arr `json:"value,omitempty"`
+}
+
 // ParseQUICTransportParameters parses the transport parameters from the extension data of
 // TLS Extension "QUIC Transport Parameters" (57)
 //
@@ -65,81 +103,45 @@ func ParseQUICTransportParameters(extData []byte) *QUICTransportParameters { //
 			return qtp
 		}
 
-		if IsGREASETransportParameter(paramType) {
+		isGREASE := IsGREASETransportParameter(paramType)
+		if isGREASE {
 			qtp.QTPIDs = append(qtp.QTPIDs, QTP_GREASE) // replace with placeholder
 		} else {
 			qtp.QTPIDs = append(qtp.QTPIDs, paramType)
 		}
 
-		if paramValLen == 0 {
-			continue // skip empty transport parameter, no need to try to read
+		if paramValLen > uint64(r.Len()) {
+			qtp.parseError = errors.New("corrupted transport parameter")
+			return qtp
 		}
 
 		paramData = make([]byte, paramValLen)
-		n, qtp.parseError = r.Read(paramData)
-		if qtp.parseError != nil {
-			qtp.parseError = fmt.Errorf("failed to read transport parameter value: %w", qtp.parseError)
-			return qtp
-		}
-		if uint64(n) != paramValLen {
-			qtp.parseError = errors.New("corrupted transport parameter")
-			return qtp
+		if paramValLen > 0 { // no need to try to read empty transport parameter
+			n, qtp.parseError = r.Read(paramData)
+			if qtp.parseError != nil {
+				qtp.parseError = fmt.Errorf("failed to read transport parameter value: %w", qtp.parseError)
+				return qtp
+			}
+			if uint64(n) != paramValLen {
+				qtp.parseError = errors.New("corrupted transport parameter")
+				return qtp
+			}
 		}
 
-		switch paramType {
-		case dicttls.QUICTransportParameter_max_idle_timeout:
-			// qtp.MaxIdleTimeoutLength = uint32(paramValLen)
-			qtp.MaxIdleTimeout = paramData
-			unsetVLIBits(qtp.MaxIdleTimeout) // toggle the UNSET_VLI_BITS flag to control behavior
-		case dicttls.QUICTransportParameter_max_udp_payload_size:
-			// qtp.MaxUDPPayloadSizeLength = uint32(paramValLen)
-			qtp.MaxUDPPayloadSize = paramData
-			unsetVLIBits(qtp.MaxUDPPayloadSize)
-		case dicttls.QUICTransportParameter_initial_max_data:
-			// qtp.InitialMaxDataLength = uint32(paramValLen)
-			qtp.InitialMaxData = paramData
-			unsetVLIBits(qtp.InitialMaxData)
-		case dicttls.QUICTransportParameter_initial_max_stream_data_bidi_local:
-			// qtp.InitialMaxStreamDataBidiLocalLength = uint32(paramValLen)
-			qtp.InitialMaxStreamDataBidiLocal = paramData
-			unsetVLIBits(qtp.InitialMaxStreamDataBidiLocal)
-		case dicttls.QUICTransportParameter_initial_max_stream_data_bidi_remote:
-			// qtp.InitialMaxStreamDataBidiRemoteLength = uint32(paramValLen)
-			qtp.InitialMaxStreamDataBidiRemote = paramData
-			unsetVLIBits(qtp.InitialMaxStreamDataBidiRemote)
-		case dicttls.QUICTransportParameter_initial_max_stream_data_uni:
-			// qtp.InitialMaxStreamDataUniLength = uint32(paramValLen)
-			qtp.InitialMaxStreamDataUni = paramData
-			unsetVLIBits(qtp.InitialMaxStreamDataUni)
-		case dicttls.QUICTransportParameter_initial_max_streams_bidi:
-			// qtp.InitialMaxStreamsBidiLength = uint32(paramValLen)
-			qtp.InitialMaxStreamsBidi = paramData
-			unsetVLIBits(qtp.InitialMaxStreamsBidi)
-		case dicttls.QUICTransportParameter_initial_max_streams_uni:
-			// qtp.InitialMaxStreamsUniLength = uint32(paramValLen)
-			qtp.InitialMaxStreamsUni = paramData
-			unsetVLIBits(qtp.InitialMaxStreamsUni)
-		case dicttls.QUICTransportParameter_ack_delay_exponent:
-			// qtp.AckDelayExponentLength = uint32(paramValLen)
-			qtp.AckDelayExponent = paramData
-			unsetVLIBits(qtp.AckDelayExponent)
-		case dicttls.QUICTransportParameter_max_ack_delay:
-			// qtp.MaxAckDelayLength = uint32(paramValLen)
-			qtp.MaxAckDelay = paramData
-			unsetVLIBits(qtp.MaxAckDelay)
-		case dicttls.QUICTransportParameter_active_connection_id_limit:
-			// qtp.ActiveConnectionIDLimitLength = uint32(paramValLen)
-			qtp.ActiveConnectionIDLimit = paramData
-			unsetVLIBits(qtp.ActiveConnectionIDLimit)
+		if isGREASE {
+			continue // GREASE values are random
 		}
 
-		// if IsGREASETransportParameter(paramType) {
-		// 	qtp.QTPIDs = append(qtp.QTPIDs, QTP_GREASE) // replace with placeholder
-		// } else {
-		// 	qtp.QTPIDs = append(qtp.QTPIDs, paramType)
-		// }
+		if !qtp.decodeParameter(paramType, paramData) {
+			qtp.UnknownParameters = append(qtp.UnknownParameters, QUICTransportParameter{
+				ID:    paramType,
+				Value: paramData,
+			})
+		}
 	}
 
+	qtp.QTPIDsOriginal = append([]uint64{}, qtp.QTPIDs...)
+
 	// sort QTPIDs
 	sort.Slice(qtp.QTPIDs, func(i, j int) bool {
 		return qtp.QTPIDs[i] < qtp.QTPIDs[j]
@@ -148,9 +150,121 @@ func ParseQUICTransportParameters(extData []byte) *QUICTransportParameters { //
 	qtp.parseError = nil
 	qtp.NumID = qtp.calcNumericID()
 	qtp.HexID = FingerprintID(qtp.NumID).AsHex()
+	qtp.OrderedNumID = qtp.calcOrderedNumericID()
+	qtp.OrderedHexID = FingerprintID(qtp.OrderedNumID).AsHex()
 	return qtp
 }
 
+// decodeParameter decodes a single non-GREASE transport parameter into its
+// typed field. It returns false if the parameter is unknown or its value is
+// malformed, in which case the caller keeps it as a raw id/value pair.
+func (qtp *QUICTransportParameters) decodeParameter(paramType uint64, paramData []byte) bool { // skipcq: GO-R1005
+	// Empty values are only valid for a few parameters
+	if len(paramData) == 0 {
+		switch paramType {
+		case dicttls.QUICTransportParameter_initial_source_connection_id:
+			qtp.InitialSourceConnectionIDLength = new(int)
+		case dicttls.QUICTransportParameter_disable_active_migration:
+			qtp.DisableActiveMigration = true
+		case dicttls.QUICTransportParameter_grease_quic_bit:
+			qtp.GreaseQUICBit = true
+		default:
+			return false
+		}
+		return true
+	}
+
+	switch paramType {
+	case dicttls.QUICTransportParameter_max_idle_timeout:
+		// qtp.MaxIdleTimeoutLength = uint32(paramValLen)
+		qtp.MaxIdleTimeout = paramData
+		unsetVLIBits(qtp.MaxIdleTimeout) // toggle the UNSET_VLI_BITS flag to control behavior
+	case dicttls.QUICTransportParameter_max_udp_payload_size:
+		// qtp.MaxUDPPayloadSizeLength = uint32(paramValLen)
+		qtp.MaxUDPPayloadSize = paramData
+		unsetVLIBits(qtp.MaxUDPPayloadSize)
+	case dicttls.QUICTransportParameter_initial_max_data:
+		// qtp.InitialMaxDataLength = uint32(paramValLen)
+		qtp.InitialMaxData = paramData
+		unsetVLIBits(qtp.InitialMaxData)
+	case dicttls.QUICTransportParameter_initial_max_stream_data_bidi_local:
+		// qtp.InitialMaxStreamDataBidiLocalLength = uint32(paramValLen)
+		qtp.InitialMaxStreamDataBidiLocal = paramData
+		unsetVLIBits(qtp.InitialMaxStreamDataBidiLocal)
+	case dicttls.QUICTransportParameter_initial_max_stream_data_bidi_remote:
+		// qtp.InitialMaxStreamDataBidiRemoteLength = uint32(paramValLen)
+		qtp.InitialMaxStreamDataBidiRemote = paramData
+		unsetVLIBits(qtp.InitialMaxStreamDataBidiRemote)
+	case dicttls.QUICTransportParameter_initial_max_stream_data_uni:
+		// qtp.InitialMaxStreamDataUniLength = uint32(paramValLen)
+		qtp.InitialMaxStreamDataUni = paramData
+		unsetVLIBits(qtp.InitialMaxStreamDataUni)
+	case dicttls.QUICTransportParameter_initial_max_streams_bidi:
+		// qtp.InitialMaxStreamsBidiLength = uint32(paramValLen)
+		qtp.InitialMaxStreamsBidi = paramData
+		unsetVLIBits(qtp.InitialMaxStreamsBidi)
+	case dicttls.QUICTransportParameter_initial_max_streams_uni:
+		// qtp.InitialMaxStreamsUniLength = uint32(paramValLen)
+		qtp.InitialMaxStreamsUni = paramData
+		unsetVLIBits(qtp.InitialMaxStreamsUni)
+	case dicttls.QUICTransportParameter_ack_delay_exponent:
+		// qtp.AckDelayExponentLength = uint32(paramValLen)
+		qtp.AckDelayExponent = paramData
+		unsetVLIBits(qtp.AckDelayExponent)
+	case dicttls.QUICTransportParameter_max_ack_delay:
+		// qtp.MaxAckDelayLength = uint32(paramValLen)
+		qtp.MaxAckDelay = paramData
+		unsetVLIBits(qtp.MaxAckDelay)
+	case dicttls.QUICTransportParameter_active_connection_id_limit:
+		// qtp.ActiveConnectionIDLimitLength = uint32(paramValLen)
+		qtp.ActiveConnectionIDLimit = paramData
+		unsetVLIBits(qtp.ActiveConnectionIDLimit)
+	case dicttls.QUICTransportParameter_initial_source_connection_id:
+		l := len(paramData)
+		qtp.InitialSourceConnectionIDLength = &l
+	case dicttls.QUICTransportParameter_max_datagram_frame_size:
+		qtp.MaxDatagramFrameSize = paramData
+		unsetVLIBits(qtp.MaxDatagramFrameSize)
+	case dicttls.QUICTransportParameter_version_information, QTP_version_information_draft:
+		if len(paramData)%4 != 0 {
+			return false
+		}
+		qtp.VersionInformation = &QUICVersionInformation{
+			ChosenVersion: binary.BigEndian.Uint32(paramData),
+		}
+		for i := 4; i < len(paramData); i += 4 {
+			qtp.VersionInformation.AvailableVersions = append(qtp.VersionInformation.AvailableVersions, binary.BigEndian.Uint32(paramData[i:]))
+		}
+	case QTP_min_ack_delay:
+		qtp.MinAckDelay = paramData
+		unsetVLIBits(qtp.MinAckDelay)
+	case dicttls.QUICTransportParameter_initial_rtt:
+		qtp.InitialRTT = paramData
+		unsetVLIBits(qtp.InitialRTT)
+	case dicttls.QUICTransportParameter_google_connection_options:
+		if len(paramData)%4 != 0 {
+			return false
+		}
+		for i := 0; i < len(paramData); i += 4 {
+			qtp.GoogleConnectionOptions = append(qtp.GoogleConnectionOptions, string(paramData[i:i+4]))
+		}
+	case dicttls.QUICTransportParameter_user_agent:
+		qtp.UserAgent = string(paramData)
+	case dicttls.QUICTransportParameter_google_version:
+		if len(paramData) != 4 {
+			return false
+		}
+		qtp.GoogleVersion = binary.BigEndian.Uint32(paramData)
+	case dicttls.QUICTransportParameter_discard:
+		// Receiver silently discards, the value is random padding.
+	default:
+		// Unknown, or only valid when sent by a server (e.g., stateless_reset_token)
+		return false
+	}
+
+	return true
+}
+
 // ParseError returns the error that occurred during parsing, if any.
 func (qtp *QUICTransportParameters) ParseError() error {
 	return qtp.parseError
@@ -55,14 +55,118 @@ var (
 			dicttls.QUICTransportParameter_google_version,
 			0xff73db, // dicttls.QUICTransportParameter_version_information,
 		},
+		QTPIDsOriginal: []uint64{
+			dicttls.QUICTransportParameter_initial_max_streams_uni,
+			dicttls.QUICTransportParameter_initial_source_connection_id,
+			dicttls.QUICTransportParameter_max_idle_timeout,
+			dicttls.QUICTransportParameter_initial_max_stream_data_bidi_local,
+			QTP_GREASE,
+			dicttls.QUICTransportParameter_initial_max_stream_data_uni,
+			dicttls.QUICTransportParameter_google_connection_options,
+			dicttls.QUICTransportParameter_max_udp_payload_size,
+			dicttls.QUICTransportParameter_max_datagram_frame_size,
+			dicttls.QUICTransportParameter_initial_max_streams_bidi,
+			0xff73db, // dicttls.QUICTransportParameter_version_information,
+			dicttls.QUICTransportParameter_google_version,
+			dicttls.QUICTransportParameter_initial_max_stream_data_bidi_remote,
+			dicttls.QUICTransportParameter_initial_max_data,
+		},
+
+		InitialSourceConnectionIDLength: new(int),
+		MaxDatagramFrameSize:            []byte{0x00, 0x01, 0x00, 0x00},
+		VersionInformation: &QUICVersionInformation{
+			ChosenVersion:     0x00000001,
+			AvailableVersions: []uint32{0xbaca5a5a, 0x00000001},
+		},
+		GoogleConnectionOptions: []string{"RVCM"},
+		GoogleVersion:           0x00000001,
 
 		HexID: "99ba8100cb63d949",
 		NumID: 11077308073883457865,
+
+		OrderedHexID: "42145cd39306dbab",
+		OrderedNumID: 4761532769812011947,
 	}
 )
 
 func TestParseQUICTransportParameters(t *testing.T) {
 	t.Run("Google Chrome", parseQUICTransportParametersGoogleChrome)
+	t.Run("Other Parameters", parseQUICTransportParametersOther)
+	t.Run("Reordered", parseQUICTransportParametersReordered)
+}
+
+func parseQUICTransportParametersReordered(t *testing.T) {
+	// move initial_max_streams_uni (first 4 bytes) to the end
+	reordered := append(append([]byte{}, rawQTPExtData_Chrome120[4:]...), rawQTPExtData_Chrome120[:4]...)
+
+	qtp := ParseQUICTransportParameters(reordered)
+	if qtp.ParseError() != nil {
+		t.Fatalf("ParseQUICTransportParameters failed: %v", qtp.ParseError())
+	}
+
+	if qtp.NumID != qtpTruth_Chrome120.NumID {
+		t.Errorf("NumID = %d, want %d", qtp.NumID, qtpTruth_Chrome120.NumID)
+	}
+	if qtp.OrderedNumID == qtpTruth_Chrome120.OrderedNumID {
+		t.Errorf("OrderedNumID = %d, must differ from the original order", qtp.OrderedNumID)
+	}
+	if qtp.QTPIDsOriginal[len(qtp.QTPIDsOriginal)-1] != dicttls.QUICTransportParameter_initial_max_streams_uni {
+		t.Errorf("QTPIDsOriginal = %v, want initial_max_streams_uni last", qtp.QTPIDsOriginal)
+	}
+}
+
+func parseQUICTransportParametersOther(t *testing.T) {
+	var raw []byte = []byte{
+		0x0c, 0x00, // disable_active_migration
+		0x0f, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, // initial_source_connection_id
+		0x80, 0x00, 0x2a, 0xb2, 0x00, // grease_quic_bit
+		0x11, 0x08, 0x00, 0x00, 0x00, 0x01, 0x6b, 0x33, 0x43, 0xcf, // version_information
+		0xc0, 0x00, 0x00, 0x00, 0xff, 0x04, 0xde, 0x1b, 0x02, 0x43, 0xe8, // min_ack_delay
+		0x71, 0x27, 0x02, 0x44, 0x00, // initial_rtt
+		0x71, 0x29, 0x04, 'c', 'u', 'r', 'l', // user_agent
+		0x40, 0x78, 0x02, 0xab, 0xcd, // GREASE
+		0x71, 0x28, 0x03, 'B', 'A', 'D', // malformed google_connection_options
+		0x80, 0x12, 0x34, 0x56, 0x01, 0xff, // unknown
+	}
+
+	qtp := ParseQUICTransportParameters(raw)
+	if qtp.ParseError() != nil {
+		t.Fatalf("ParseQUICTransportParameters failed: %v", qtp.ParseError())
+	}
+
+	if !qtp.DisableActiveMigration || !qtp.GreaseQUICBit {
+		t.Errorf("DisableActiveMigration = %v, GreaseQUICBit = %v, want true, true", qtp.DisableActiveMigration, qtp.GreaseQUICBit)
+	}
+	if qtp.InitialSourceConnectionIDLength == nil || *qtp.InitialSourceConnectionIDLength != 8 {
+		t.Errorf("InitialSourceConnectionIDLength = %v, want 8", qtp.InitialSourceConnectionIDLength)
+	}
+	if !reflect.DeepEqual(qtp.VersionInformation, &QUICVersionInformation{ChosenVersion: QUICVersion1, AvailableVersions: []uint32{QUICVersion2}}) {
+		t.Errorf("VersionInformation = %+v", qtp.VersionInformation)
+	}
+	if !reflect.DeepEqual([]byte(qtp.MinAckDelay), []byte{0x03, 0xe8}) {
+		t.Errorf("MinAckDelay = %v, want [3 232]", qtp.MinAckDelay)
+	}
+	if !reflect.DeepEqual([]byte(qtp.InitialRTT), []byte{0x04, 0x00}) {
+		t.Errorf("InitialRTT = %v, want [4 0]", qtp.InitialRTT)
+	}
+	if qtp.UserAgent != "curl" {
+		t.Errorf("UserAgent = %q, want \"curl\"", qtp.UserAgent)
+	}
+	if qtp.GoogleConnectionOptions != nil {
+		t.Errorf("GoogleConnectionOptions = %v, want nil", qtp.GoogleConnectionOptions)
+	}
+
+	unknownTruth := []QUICTransportParameter{
+		{ID: dicttls.QUICTransportParameter_google_connection_options, Value: []byte{'B', 'A', 'D'}},
+		{ID: 0x123456, Value: []byte{0xff}},
+	}
+	if !reflect.DeepEqual(qtp.UnknownParameters, unknownTruth) {
+		t.Errorf("UnknownParameters = %v, want %v", qtp.UnknownParameters, unknownTruth)
+	}
+
+	if len(qtp.QTPIDsOriginal) != 10 || qtp.QTPIDsOriginal[0] != dicttls.QUICTransportParameter_disable_active_migration || qtp.QTPIDsOriginal[7] != QTP_GREASE {
+		t.Errorf("QTPIDsOriginal = %v", qtp.QTPIDsOriginal)
+	}
 }
 
 func parseQUICTransportParametersGoogleChrome(t *testing.T) {
@@ -1,18 +1,24 @@
 package clienthellod_test
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
 	"errors"
 	"testing"
+	"time"
 
 	. "github.com/refraction-networking/clienthellod"
 )
 
-// DecodeQUICHeaderAndFrames must reject non-v1 Initials before deriving keys.
-// A GREASE-version probe (e.g. quiche's 0xbabababa) reuses the real
-// connection's DCID; clienthellod can only decrypt QUIC v1, and feeding a
-// non-v1 Initial decrypted with v1 keys corrupts ClientHello reconstruction
-// under the shared DCID — which previously suppressed the fingerprint entirely.
-func TestDecodeQUICHeaderRejectsNonV1Version(t *testing.T) {
+// DecodeQUICHeaderAndFrames must reject unsupported versions before deriving
+// keys. A GREASE-version probe (e.g. quiche's 0xbabababa) reuses the real
+// connection's DCID; clienthellod can only decrypt QUIC v1 and v2, and feeding
+// an Initial of another version decrypted with v1 keys corrupts ClientHello
+// reconstruction under the shared DCID — which previously suppressed the
+// fingerprint entirely.
+func TestDecodeQUICHeaderRejectsUnsupportedVersion(t *testing.T) {
 	// Sanity: the unmodified vector is QUIC v1 and decodes cleanly.
 	if _, _, err := DecodeQUICHeaderAndFrames(quicIETFData_Chrome125_PKN1); err != nil {
 		t.Fatalf("v1 Initial should decode, got %v", err)
@@ -20,7 +26,7 @@ func TestDecodeQUICHeaderRejectsNonV1Version(t *testing.T) {
 
 	for name, version := range map[string][4]byte{
 		"GREASE_babababa": {0xba, 0xba, 0xba, 0xba},
-		"QUICv2":          {0x6b, 0x33, 0x43, 0xcf},
+		"draft-29":        {0xff, 0x00, 0x00, 0x1d},
 		"version_zero":    {0x00, 0x00, 0x00, 0x00},
 	} {
 		t.Run(name, func(t *testing.T) {
@@ -32,3 +38,151 @@ func TestDecodeQUICHeaderRejectsNonV1Version(t *testing.T) {
 		})
 	}
 }
+
+// Test vector from RFC 9369, Appendix A.1.
+func TestClientInitialKeysCalcV2(t *testing.T) {
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+
+	clientKey, clientIV, clientHpKey, err := ClientInitialKeysCalcWithVersion(QUICVersion2, dcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		got, want string
+	}{
+		{"key", hex.EncodeToString(clientKey), "8b1a0bc121284290a29e0971b5cd045d"},
+		{"iv", hex.EncodeToString(clientIV), "91f73e2351d8fa91660e909f"},
+		{"hp", hex.EncodeToString(clientHpKey), "45b95e15235d6f45a6b19cbcb0294ba9"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("client %s = %s, want %s", tc.name, tc.got, tc.want)
+		}
+	}
+
+	if _, _, _, err := ClientInitialKeysCalcWithVersion(0xbabababa, dcid); !errors.Is(err, ErrUnsupportedQUICVersion) {
+		t.Errorf("expected ErrUnsupportedQUICVersion, got %v", err)
+	}
+}
+
+func TestDecodeQUICHeaderAndFramesV2(t *testing.T) {
+	v1 := [][]byte{quicIETFData_Chrome125_PKN1, quicIETFData_Chrome125_PKN2}
+	gciV1 := GatherClientInitialsWithDeadline(time.Now().Add(time.Second))
+	gciV2 := GatherClientInitialsWithDeadline(time.Now().Add(time.Second))
+
+	for _, pkt := range v1 {
+		v2 := reprotectInitialAsV2(t, pkt)
+
+		hdr, frames, err := DecodeQUICHeaderAndFrames(v2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(hdr.Version, []byte{0x6b, 0x33, 0x43, 0xcf}) {
+			t.Fatalf("header.Version = %x, want 6b3343cf", hdr.Version)
+		}
+
+		_, framesV1, err := DecodeQUICHeaderAndFrames(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testQUICFramesEqualsTruth(t, frames, framesV1)
+
+		for gci, p := range map[*GatheredClientInitials][]byte{gciV1: pkt, gciV2: v2} {
+			ci, err := UnmarshalQUICClientInitialPacket(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = gci.AddPacket(ci); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if !gciV2.Completed() {
+		t.Fatal("v2 GatheredClientInitials is not completed")
+	}
+	if gciV1.ClientHello.NormNumID != gciV2.ClientHello.NormNumID {
+		t.Errorf("ClientHello fingerprints differ between v1 and v2")
+	}
+	if gciV1.NumID == gciV2.NumID {
+		t.Errorf("QUIC header fingerprint does not reflect the version")
+	}
+}
+
+// reprotectInitialAsV2 removes the v1 packet protection from a client Initial
+// and protects it again as a QUIC v2 Initial (RFC 9369).
+func reprotectInitialAsV2(t *testing.T, v1 []byte) []byte {
+	t.Helper()
+
+	pkt := append([]byte(nil), v1...)
+	dcid := pkt[6 : 6+int(pkt[5])]
+	off := 6 + len(dcid)
+	off += 1 + int(pkt[off]) // SCID
+	tokenLen, n, err := ReadNextVLI(bytes.NewReader(pkt[off:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	off += n + int(tokenLen)
+	length, n, err := ReadNextVLI(bytes.NewReader(pkt[off:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pnOffset := off + n
+	end := pnOffset + int(length)
+
+	// remove v1 protection
+	key, iv, hpKey, err := ClientInitialKeysCalcWithVersion(QUICVersion1, dcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mask, err := ComputeHeaderProtection(hpKey, pkt[pnOffset+4:pnOffset+20])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt[0] ^= mask[0] & 0x0f
+	pnLen := int(pkt[0]&0x03) + 1
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(pkt[pnOffset+i])
+	}
+	hdrEnd := pnOffset + pnLen
+	plaintext, err := DecryptAES128GCM(append([]byte(nil), iv...), pn, key,
+		pkt[hdrEnd:end-16], pkt[:hdrEnd], pkt[end-16:end])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// apply v2 protection
+	pkt[0] = pkt[0]&^0x30 | 0x10 // Initial packet type is 0b01 in v2
+	copy(pkt[1:5], []byte{0x6b, 0x33, 0x43, 0xcf})
+	key, iv, hpKey, err = ClientInitialKeysCalcWithVersion(QUICVersion2, dcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		iv[11-i] ^= byte(pn >> (8 * i))
+	}
+	sealed := aead.Seal(nil, iv, plaintext, pkt[:hdrEnd])
+	copy(pkt[hdrEnd:end], sealed)
+
+	mask, err = ComputeHeaderProtection(hpKey, pkt[pnOffset+4:pnOffset+20])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt[0] ^= mask[0] & 0x0f
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOffset+i] ^= mask[1+i]
+	}
+
+	return pkt
+}
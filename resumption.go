@@ -0,0 +1,69 @@
+package clienthellod
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// PreSharedKey is the pre_shared_key(41) extension of a ClientHello,
+// without the identities and binders themselves.
+type PreSharedKey struct {
+	Identities    []PSKIdentity `json:"identities"`
+	BinderLengths []uint8       `json:"binder_lengths"`
+}
+
+// PSKIdentity is a PskIdentity offered in the pre_shared_key extension.
+type PSKIdentity struct {
+	Length uint16 `json:"length"` // length of the identity, e.g., a session ticket
+
+	// ObfuscatedTicketAge tells if the obfuscated_ticket_age is set. It is
+	// zero for external PSKs, which are not derived from a session ticket.
+	ObfuscatedTicketAge bool `json:"obfuscated_ticket_age"`
+}
+
+// parsePreSharedKey parses the data of a pre_shared_key extension sent by
+// a client, i.e., an OfferedPsks.
+func parsePreSharedKey(extensionData cryptobyte.String) (*PreSharedKey, error) {
+	var identities, binders cryptobyte.String
+	if !extensionData.ReadUint16LengthPrefixed(&identities) || identities.Empty() {
+		return nil, errors.New("unable to read PSK identities")
+	}
+	if !extensionData.ReadUint16LengthPrefixed(&binders) || binders.Empty() {
+		return nil, errors.New("unable to read PSK binders")
+	}
+	if !extensionData.Empty() {
+		return nil, errors.New("trailing data after PSK binders")
+	}
+
+	psk := &PreSharedKey{}
+	for !identities.Empty() {
+		var identity cryptobyte.String
+		var obfuscatedTicketAge uint32
+		if !identities.ReadUint16LengthPrefixed(&identity) || !identities.ReadUint32(&obfuscatedTicketAge) {
+			return nil, errors.New("unable to read PSK identity")
+		}
+		psk.Identities = append(psk.Identities, PSKIdentity{
+			Length:              uint16(len(identity)),
+			ObfuscatedTicketAge: obfuscatedTicketAge != 0,
+		})
+	}
+	for !binders.Empty() {
+		var binder cryptobyte.String
+		if !binders.ReadUint8LengthPrefixed(&binder) {
+			return nil, errors.New("unable to read PSK binder")
+		}
+		psk.BinderLengths = append(psk.BinderLengths, uint8(len(binder)))
+	}
+
+	return psk, nil
+}
+
+// IsResumption tells if the client attempts to resume a previous session,
+// either with a TLS 1.3 PSK or a TLS 1.2 session ticket.
+//
+// The legacy session ID is not considered since TLS 1.3 clients send a
+// random one in middlebox compatibility mode.
+func (ch *ClientHello) IsResumption() bool {
+	return (ch.PreSharedKey != nil && len(ch.PreSharedKey.Identities) > 0) || ch.SessionTicketLength > 0
+}
@@ -0,0 +1,137 @@
+package clienthellod_test
+
+import (
+	"reflect"
+	"testing"
+
+	tls "github.com/refraction-networking/utls"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+// resumptionClientHello builds a TLS 1.3 ClientHello record with the given
+// extension data for session_ticket, early_data and pre_shared_key, each
+// omitted if nil.
+func resumptionClientHello(t *testing.T, sessionTicket, earlyData, psk []byte) []byte {
+	t.Helper()
+
+	exts := []tls.TLSExtension{
+		&tls.SNIExtension{},
+		&tls.SupportedCurvesExtension{Curves: []tls.CurveID{tls.X25519}},
+		&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256}},
+		&tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519}}},
+		&tls.SupportedVersionsExtension{Versions: []uint16{tls.VersionTLS13}},
+		&tls.PSKKeyExchangeModesExtension{Modes: []uint8{tls.PskModeDHE}},
+	}
+	if sessionTicket != nil {
+		exts = append(exts, &tls.GenericExtension{Id: 35, Data: sessionTicket})
+	}
+	if earlyData != nil {
+		exts = append(exts, &tls.GenericExtension{Id: 42, Data: earlyData})
+	}
+	if psk != nil {
+		exts = append(exts, &tls.GenericExtension{Id: 41, Data: psk}) // must be the last extension
+	}
+
+	uconn := tls.UClient(nil, &tls.Config{ServerName: "example.com"}, tls.HelloCustom) // skipcq: GSC-G402
+	if err := uconn.ApplyPreset(&tls.ClientHelloSpec{
+		CipherSuites:       []uint16{tls.TLS_AES_128_GCM_SHA256},
+		CompressionMethods: []byte{0},
+		Extensions:         exts,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uconn.BuildHandshakeState(); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := uconn.HandshakeState.Hello.Raw
+	return append([]byte{0x16, 0x03, 0x01, byte(len(hs) >> 8), byte(len(hs))}, hs...)
+}
+
+func TestClientHelloResumption(t *testing.T) {
+	// two identities: a 192-byte ticket and a 16-byte external PSK, with
+	// SHA-256 and SHA-384 binders
+	psk := []byte{0, 2 + 192 + 4 + 2 + 16 + 4}
+	psk = append(psk, 0, 192)
+	psk = append(psk, make([]byte, 192)...)
+	psk = append(psk, 0x12, 0x34, 0x56, 0x78)
+	psk = append(psk, 0, 16)
+	psk = append(psk, make([]byte, 16)...)
+	psk = append(psk, 0, 0, 0, 0)
+	psk = append(psk, 0, 1+32+1+48, 32)
+	psk = append(psk, make([]byte, 32)...)
+	psk = append(psk, 48)
+	psk = append(psk, make([]byte, 48)...)
+
+	for name, tc := range map[string]struct {
+		sessionTicket, earlyData, psk []byte
+
+		wantTicketLength int
+		wantPSK          *PreSharedKey
+		wantEarlyData    bool
+		wantResumption   bool
+	}{
+		"Fresh": {},
+		"NewTicket": {
+			sessionTicket: []byte{},
+		},
+		"TLS12Ticket": {
+			sessionTicket:    make([]byte, 160),
+			wantTicketLength: 160,
+			wantResumption:   true,
+		},
+		"PSK": {
+			psk: psk,
+			wantPSK: &PreSharedKey{
+				Identities:    []PSKIdentity{{Length: 192, ObfuscatedTicketAge: true}, {Length: 16}},
+				BinderLengths: []uint8{32, 48},
+			},
+			wantResumption: true,
+		},
+		"EarlyData": {
+			earlyData: []byte{},
+			psk:       psk,
+			wantPSK: &PreSharedKey{
+				Identities:    []PSKIdentity{{Length: 192, ObfuscatedTicketAge: true}, {Length: 16}},
+				BinderLengths: []uint8{32, 48},
+			},
+			wantEarlyData:  true,
+			wantResumption: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ch := mustUnmarshalClientHello(t, resumptionClientHello(t, tc.sessionTicket, tc.earlyData, tc.psk))
+			if ch.SessionIDLength != 32 {
+				t.Errorf("SessionIDLength = %d, want 32", ch.SessionIDLength)
+			}
+			if ch.SessionTicketLength != tc.wantTicketLength {
+				t.Errorf("SessionTicketLength = %d, want %d", ch.SessionTicketLength, tc.wantTicketLength)
+			}
+			if !reflect.DeepEqual(ch.PreSharedKey, tc.wantPSK) {
+				t.Errorf("PreSharedKey = %+v, want %+v", ch.PreSharedKey, tc.wantPSK)
+			}
+			if ch.EarlyData != tc.wantEarlyData {
+				t.Errorf("EarlyData = %t, want %t", ch.EarlyData, tc.wantEarlyData)
+			}
+			if ch.IsResumption() != tc.wantResumption {
+				t.Errorf("IsResumption() = %t, want %t", ch.IsResumption(), tc.wantResumption)
+			}
+		})
+	}
+
+	if _, err := UnmarshalClientHello(resumptionClientHello(t, nil, nil, psk[:100])); err == nil {
+		t.Error("expected error for a truncated pre_shared_key")
+	}
+}
+
+func TestClientHelloResumptionFirefox(t *testing.T) {
+	ch := mustUnmarshalClientHello(t, tlsClientHello_Firefox126)
+	if ch.SessionIDLength != 32 || ch.SessionTicketLength != 0 || ch.PreSharedKey != nil || ch.EarlyData {
+		t.Errorf("got session ID length %d, ticket length %d, PSK %+v and early data %t",
+			ch.SessionIDLength, ch.SessionTicketLength, ch.PreSharedKey, ch.EarlyData)
+	}
+	if ch.IsResumption() {
+		t.Error("IsResumption() = true for a fresh handshake")
+	}
+}
@@ -0,0 +1,286 @@
+package clienthellod
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"github.com/refraction-networking/clienthellod/internal/utils"
+)
+
+// FingerprintStore is the storage used by [TLSFingerprinter] and
+// [QUICFingerprinter] to keep fingerprints until they are looked up or expired.
+//
+// The method set is a subset of [sync.Map], which is the default (unbounded)
+// store. Use [NewLRUStore] for a bounded store.
+type FingerprintStore interface {
+	Load(key any) (value any, ok bool)
+	Store(key, value any)
+	LoadOrStore(key, value any) (actual any, loaded bool)
+	LoadAndDelete(key any) (value any, loaded bool)
+	Delete(key any)
+	CompareAndDelete(key, old any) (deleted bool)
+}
+
+const (
+	// lruEntryOverhead is the approximated memory used by an entry in
+	// LRUStore on top of the key and value.
+	lruEntryOverhead = 128
+
+	// quicMaxInitialPacketSize is the upper bound of a QUIC Initial packet
+	// kept in GatheredClientInitials.
+	quicMaxInitialPacketSize = 1500
+)
+
+// LRUStore is a [FingerprintStore] bounded in number of entries and in
+// approximated memory usage. When a bound is exceeded, the least recently
+// used entries are evicted.
+//
+// It is safe for concurrent use.
+type LRUStore struct {
+	maxEntries int
+	maxBytes   int64
+
+	mutex   sync.Mutex
+	lru     *list.List // front is the most recently used
+	entries map[any]*list.Element
+	bytes   int64
+
+	evictions atomic.Uint64
+	onEvict   []func(key, value any)
+}
+
+type lruEntry struct {
+	key   any
+	value any
+	size  int64
+}
+
+// NewLRUStore creates a new LRUStore holding at most maxEntries entries
+// using at most maxBytes bytes (approximated). A non-positive bound means
+// no limit on that dimension.
+func NewLRUStore(maxEntries int, maxBytes int64) *LRUStore {
+	return &LRUStore{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		entries:    make(map[any]*list.Element),
+	}
+}
+
+// Load implements FingerprintStore. A hit marks the entry as recently used.
+func (s *LRUStore) Load(key any) (value any, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*lruEntry).value, true
+}
+
+// Store implements FingerprintStore.
+func (s *LRUStore) Store(key, value any) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		if entry.value != value {
+			s.lockedNotifyEvict(key, entry.value)
+		}
+		s.bytes -= entry.size
+		entry.value = value
+		entry.size = approxStoreEntrySize(key, value)
+		s.bytes += entry.size
+		s.lru.MoveToFront(elem)
+	} else {
+		s.lockedInsert(key, value)
+	}
+
+	s.lockedEvict()
+}
+
+// LoadOrStore implements FingerprintStore.
+func (s *LRUStore) LoadOrStore(key, value any) (actual any, loaded bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(elem)
+		return elem.Value.(*lruEntry).value, true
+	}
+
+	s.lockedInsert(key, value)
+	s.lockedEvict()
+	return value, false
+}
+
+// LoadAndDelete implements FingerprintStore.
+func (s *LRUStore) LoadAndDelete(key any) (value any, loaded bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lockedRemove(elem)
+	return elem.Value.(*lruEntry).value, true
+}
+
+// Delete implements FingerprintStore.
+func (s *LRUStore) Delete(key any) {
+	s.LoadAndDelete(key)
+}
+
+// CompareAndDelete implements FingerprintStore.
+func (s *LRUStore) CompareAndDelete(key, old any) (deleted bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok || elem.Value.(*lruEntry).value != old {
+		return false
+	}
+	s.lockedRemove(elem)
+	return true
+}
+
+// Len returns the number of entries in the store.
+func (s *LRUStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lru.Len()
+}
+
+// Bytes returns the approximated memory used by the entries in the store.
+func (s *LRUStore) Bytes() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.bytes
+}
+
+// Evictions returns the number of entries evicted so far to stay within the
+// bounds. Entries deleted explicitly are not counted.
+func (s *LRUStore) Evictions() uint64 {
+	return s.evictions.Load()
+}
+
+func (s *LRUStore) lockedInsert(key, value any) {
+	entry := &lruEntry{
+		key:   key,
+		value: value,
+		size:  approxStoreEntrySize(key, value),
+	}
+	s.entries[key] = s.lru.PushFront(entry)
+	s.bytes += entry.size
+}
+
+func (s *LRUStore) lockedRemove(elem *list.Element) {
+	entry := elem.Value.(*lruEntry)
+	s.lru.Remove(elem)
+	delete(s.entries, entry.key)
+	s.bytes -= entry.size
+}
+
+// lockedEvict evicts the least recently used entries until the store is
+// within its bounds. The most recently used entry is never evicted, even if
+// it alone exceeds maxBytes.
+func (s *LRUStore) lockedEvict() {
+	for s.lru.Len() > 1 &&
+		((s.maxEntries > 0 && s.lru.Len() > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes)) {
+		elem := s.lru.Back()
+		s.lockedRemove(elem)
+		s.evictions.Add(1)
+
+		entry := elem.Value.(*lruEntry)
+		s.lockedNotifyEvict(entry.key, entry.value)
+	}
+}
+
+func (s *LRUStore) lockedNotifyEvict(key, value any) {
+	for _, f := range s.onEvict {
+		f(key, value)
+	}
+}
+
+// notifyEvict implements evictNotifier.
+func (s *LRUStore) notifyEvict(f func(key, value any)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onEvict = append(s.onEvict, f)
+}
+
+// evictNotifier is implemented by stores dropping entries on their own,
+// i.e., evicting them or replacing them on Store, so that their pending
+// expiry can be cancelled.
+type evictNotifier interface {
+	notifyEvict(f func(key, value any))
+}
+
+// storeExpiry is the key of the pending expiry of a stored entry. The token
+// tells apart entries successively stored under the same key, so that the
+// janitor never deletes a newer entry and does not retain the entry itself.
+type storeExpiry struct {
+	key   any
+	token uint64
+}
+
+var lastExpiryToken atomic.Uint64
+
+// newStoreJanitor creates a janitor deleting the entries of the store as
+// their storeExpiry are reached, unless they were replaced since.
+func newStoreJanitor(store FingerprintStore) *utils.Janitor {
+	janitor := utils.NewJanitor(func(key, _ any) {
+		expiry := key.(storeExpiry)
+		if value, ok := store.Load(expiry.key); ok && expiryToken(value) == expiry.token {
+			store.CompareAndDelete(expiry.key, value)
+		}
+	})
+	if n, ok := store.(evictNotifier); ok {
+		n.notifyEvict(func(key, value any) {
+			janitor.Cancel(storeExpiry{key, expiryToken(value)})
+		})
+	}
+	return janitor
+}
+
+// expiryToken returns the token of a value saved by the fingerprinters.
+func expiryToken(value any) uint64 {
+	switch v := value.(type) {
+	case *ClientHello:
+		return v.expiryToken
+	case *GatheredClientInitials:
+		return v.expiryToken
+	}
+	return 0
+}
+
+// approxStoreEntrySize approximates the memory retained by a stored entry.
+//
+// GatheredClientInitials grows after being stored, so its upper bound is
+// used instead of its current size.
+func approxStoreEntrySize(key, value any) int64 {
+	size := int64(lruEntryOverhead)
+	if k, ok := key.(string); ok {
+		size += int64(len(k))
+	}
+
+	switch v := value.(type) {
+	case *ClientHello:
+		size += 2 * int64(len(v.raw)) // raw bytes and the parsed fields
+	case *GatheredClientInitials:
+		size += 2 * int64(atomic.LoadUint64(&v.maxPacketCount)) * quicMaxInitialPacketSize // packets and the reassembled ClientHello
+	}
+
+	return size
+}
+
+// type guards
+var (
+	_ FingerprintStore = (*sync.Map)(nil)
+	_ FingerprintStore = (*LRUStore)(nil)
+)
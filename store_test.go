@@ -0,0 +1,177 @@
+package clienthellod_test
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+func TestLRUStoreMaxEntries(t *testing.T) {
+	store := NewLRUStore(2, 0)
+
+	store.Store("a", 1)
+	store.Store("b", 2)
+	if _, ok := store.Load("a"); !ok { // a becomes the most recently used
+		t.Fatal("a not found")
+	}
+	store.Store("c", 3) // evicts b
+
+	if _, ok := store.Load("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := store.Load(key); !ok {
+			t.Errorf("%s should not have been evicted", key)
+		}
+	}
+	if store.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", store.Len())
+	}
+	if store.Evictions() != 1 {
+		t.Errorf("Evictions() = %d, want 1", store.Evictions())
+	}
+
+	// explicit deletion is not an eviction
+	if v, ok := store.LoadAndDelete("a"); !ok || v != 1 {
+		t.Errorf("LoadAndDelete(a) = %v, %v, want 1, true", v, ok)
+	}
+	if store.CompareAndDelete("c", 4) {
+		t.Error("CompareAndDelete(c, 4) should fail")
+	}
+	if !store.CompareAndDelete("c", 3) {
+		t.Error("CompareAndDelete(c, 3) should succeed")
+	}
+	if store.Len() != 0 || store.Bytes() != 0 {
+		t.Errorf("Len() = %d, Bytes() = %d, want 0, 0", store.Len(), store.Bytes())
+	}
+	if store.Evictions() != 1 {
+		t.Errorf("Evictions() = %d, want 1", store.Evictions())
+	}
+}
+
+func TestLRUStoreMaxBytes(t *testing.T) {
+	ch := mustUnmarshalClientHello(t, tlsClientHello_Firefox126)
+
+	single := NewLRUStore(0, 0)
+	single.Store("0", ch)
+	entrySize := single.Bytes()
+	if entrySize <= int64(len(ch.Raw())) {
+		t.Fatalf("Bytes() = %d, want more than the raw ClientHello (%d)", entrySize, len(ch.Raw()))
+	}
+
+	store := NewLRUStore(0, 3*entrySize)
+	for i := 0; i < 10; i++ {
+		store.Store(fmt.Sprint(i), ch)
+	}
+
+	if store.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", store.Len())
+	}
+	if store.Bytes() > 3*entrySize {
+		t.Errorf("Bytes() = %d, want at most %d", store.Bytes(), 3*entrySize)
+	}
+	if store.Evictions() != 7 {
+		t.Errorf("Evictions() = %d, want 7", store.Evictions())
+	}
+	if _, ok := store.Load("9"); !ok {
+		t.Error("most recent entry should not have been evicted")
+	}
+}
+
+func TestLRUStoreLoadOrStore(t *testing.T) {
+	store := NewLRUStore(1, 0)
+
+	if actual, loaded := store.LoadOrStore("a", 1); loaded || actual != 1 {
+		t.Errorf("LoadOrStore(a, 1) = %v, %v, want 1, false", actual, loaded)
+	}
+	if actual, loaded := store.LoadOrStore("a", 2); !loaded || actual != 1 {
+		t.Errorf("LoadOrStore(a, 2) = %v, %v, want 1, true", actual, loaded)
+	}
+	if _, loaded := store.LoadOrStore("b", 3); loaded {
+		t.Error("LoadOrStore(b, 3) should store")
+	}
+	if _, ok := store.Load("a"); ok {
+		t.Error("a should have been evicted")
+	}
+}
+
+func TestLRUStoreConcurrent(t *testing.T) {
+	store := NewLRUStore(16, 0)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("%d-%d", g, i%32)
+				store.LoadOrStore(key, i)
+				store.Load(key)
+				if i%3 == 0 {
+					store.Delete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if store.Len() > 16 {
+		t.Errorf("Len() = %d, want at most 16", store.Len())
+	}
+}
+
+func TestTLSFingerprinterWithStore(t *testing.T) {
+	store := NewLRUStore(1, 0)
+	tfp := NewTLSFingerprinterWithStore(store)
+	defer tfp.Close()
+
+	if err := tfp.HandleMessage("10.0.0.1:1234", tlsClientHello_Firefox126); err != nil {
+		t.Fatal(err)
+	}
+	if err := tfp.HandleMessage("10.0.0.2:1234", tlsClientHello_Firefox126); err != nil {
+		t.Fatal(err)
+	}
+
+	if tfp.Peek("10.0.0.1:1234") != nil {
+		t.Error("first ClientHello should have been evicted")
+	}
+	if tfp.Peek("10.0.0.2:1234") == nil {
+		t.Error("second ClientHello not found")
+	}
+	if store.Evictions() != 1 {
+		t.Errorf("Evictions() = %d, want 1", store.Evictions())
+	}
+}
+
+func TestTLSFingerprinterWithStoreReleasesEvicted(t *testing.T) {
+	tfp := NewTLSFingerprinterWithStore(NewLRUStore(1, 0))
+	tfp.SetTimeout(time.Hour)
+	defer tfp.Close()
+
+	if err := tfp.HandleMessage("10.0.0.1:1234", tlsClientHello_Firefox126); err != nil {
+		t.Fatal(err)
+	}
+	released := make(chan struct{})
+	ch := tfp.Peek("10.0.0.1:1234")
+	runtime.SetFinalizer(ch, nil)
+	runtime.SetFinalizer(ch, func(*ClientHello) { close(released) })
+	ch = nil
+
+	if err := tfp.HandleMessage("10.0.0.2:1234", tlsClientHello_Firefox126); err != nil { // evicts the first ClientHello
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		runtime.GC()
+		select {
+		case <-released:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("evicted ClientHello is retained until its expiry")
+}
@@ -0,0 +1,304 @@
+package clienthellod
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/clienthellod/internal/utils"
+)
+
+var (
+	ErrNeedMoreSegments = errors.New("need more TCP segments")
+	ErrTCPStreamDone    = errors.New("TCP stream already handled")
+	ErrTCPStreamTooLong = errors.New("TCP stream exceeds reassembly buffer")
+)
+
+const (
+	// maxTCPReassemblyBuffer is the maximum number of bytes, in order or not,
+	// buffered per TCP stream while waiting for a complete ClientHello.
+	maxTCPReassemblyBuffer = 0x10000 // 64KiB
+
+	// maxTCPUnanchoredSegments is the maximum number of segments buffered for
+	// a stream before its first byte is located, i.e., before the SYN or a
+	// segment starting with a TLS handshake record is seen. It keeps non-TLS
+	// streams joined mid-way from hogging memory.
+	maxTCPUnanchoredSegments = 8
+
+	// maxTCPPendingSegments is the maximum number of out-of-order segments
+	// buffered for a stream, so that a flood of tiny segments cannot make
+	// the reassembly expensive.
+	maxTCPPendingSegments = 256
+
+	tlsRecordTypeHandshake = 0x16
+)
+
+// TCPReassembler extracts ClientHellos from individual TCP segments sent by
+// clients, e.g., read from a raw socket or a packet capture, where a large
+// ClientHello (such as one carrying a post-quantum key share) may span
+// multiple segments.
+//
+// Segments may arrive out of order or be retransmitted. The first byte of a
+// stream is located by its SYN, or otherwise by the first segment starting
+// with a TLS handshake record. Sequence numbers wrapping around 2^32 are
+// handled. A SYN received after the stream has been handled starts a new
+// stream, e.g., when the client reuses its source port.
+type TCPReassembler struct {
+	mutex   sync.Mutex
+	streams map[string]*tcpStream
+	janitor *utils.Janitor
+
+	timeout time.Duration
+}
+
+type tcpStream struct {
+	anchored bool
+	isn      uint32 // sequence number of the first byte of the stream
+	buf      []byte // contiguous bytes from isn
+
+	pending      []tcpSegment // not yet contiguous, sorted by offset from isn once anchored
+	pendingBytes int
+
+	done bool // ClientHello extracted or stream abandoned
+}
+
+type tcpSegment struct {
+	seq     uint32
+	payload []byte
+}
+
+// NewTCPReassembler creates a new TCPReassembler. Streams not completed or
+// removed with [TCPReassembler.Delete] are forgotten after timeout. A zero
+// timeout keeps every stream until it is deleted.
+func NewTCPReassembler(timeout time.Duration) *TCPReassembler {
+	r := &TCPReassembler{
+		streams: make(map[string]*tcpStream),
+		timeout: timeout,
+	}
+	r.janitor = utils.NewJanitor(func(key, stream any) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if r.streams[key.(string)] == stream {
+			delete(r.streams, key.(string))
+		}
+	})
+	return r
+}
+
+// SetTimeout sets the timeout after which streams are forgotten, for the
+// streams created from now on. A zero timeout keeps every stream until it
+// is deleted.
+func (r *TCPReassembler) SetTimeout(timeout time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.timeout = timeout
+}
+
+// AddSegment adds a segment sent by the client of the TCP stream identified
+// by key, which is opaque to the reassembler, e.g., the client address. seq
+// is the sequence number of the segment and syn tells if its SYN flag is
+// set.
+//
+// It returns the parsed ClientHello once all of its bytes are received, as
+// [ReadClientHello] followed by [ClientHello.ParseClientHello] would on the
+// reassembled stream. Otherwise, it returns [ErrNeedMoreSegments] while the
+// ClientHello is incomplete, [ErrTCPStreamDone] for segments received after
+// the stream has been handled, or the error which caused the stream to be
+// abandoned.
+func (r *TCPReassembler) AddSegment(key string, seq uint32, syn bool, payload []byte) (*ClientHello, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stream := r.streams[key]
+	if stream == nil || (stream.done && syn) {
+		if !syn && len(payload) == 0 {
+			return nil, ErrNeedMoreSegments // pure ACK, nothing to track yet
+		}
+		stream = &tcpStream{}
+		r.streams[key] = stream
+		if r.timeout > 0 {
+			r.janitor.Schedule(r.timeout, key, stream)
+		} else {
+			r.janitor.Cancel(key) // of a previous stream of the same key
+		}
+	}
+	if stream.done {
+		return nil, ErrTCPStreamDone
+	}
+
+	if syn {
+		seq++ // SYN consumes one sequence number, data (if any) follows
+		if !stream.anchored {
+			stream.anchor(seq)
+		}
+	} else if !stream.anchored && len(payload) > 0 && payload[0] == tlsRecordTypeHandshake {
+		stream.anchor(seq)
+	}
+
+	if err := stream.add(seq, payload); err != nil {
+		stream.abandon()
+		return nil, err
+	}
+
+	if len(stream.buf) == 0 {
+		return nil, ErrNeedMoreSegments
+	}
+
+	ch, err := ReadClientHello(bytes.NewReader(stream.buf))
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrNeedMoreSegments
+		}
+		stream.abandon()
+		return nil, err
+	}
+	stream.abandon() // nothing more is needed from this stream
+
+	if err = ch.ParseClientHello(); err != nil {
+		return nil, fmt.Errorf("failed to parse ClientHello: %w", err)
+	}
+	return ch, nil
+}
+
+// Delete forgets the TCP stream identified by key, e.g., when the
+// connection is closed.
+func (r *TCPReassembler) Delete(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.streams, key)
+	r.janitor.Cancel(key)
+}
+
+// Len returns the number of TCP streams tracked, including the handled
+// ones not yet forgotten.
+func (r *TCPReassembler) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.streams)
+}
+
+// Close stops expiring streams.
+func (r *TCPReassembler) Close() {
+	r.janitor.Close()
+}
+
+// anchor sets the sequence number of the first byte of the stream and
+// moves the pending segments received so far into place.
+func (s *tcpStream) anchor(isn uint32) {
+	s.anchored = true
+	s.isn = isn
+	slices.SortFunc(s.pending, func(a, b tcpSegment) int {
+		return int(s.offset(a.seq)) - int(s.offset(b.seq))
+	})
+	s.drain()
+}
+
+// offset returns the offset of a sequence number from the first byte of the
+// stream, negative if it is before.
+func (s *tcpStream) offset(seq uint32) int32 {
+	return int32(seq - s.isn)
+}
+
+// add adds a segment to the stream. Bytes already received are ignored, so
+// retransmitted and overlapping segments are harmless.
+func (s *tcpStream) add(seq uint32, payload []byte) error {
+	if len(payload) == 0 {
+		return nil
+	}
+
+	if !s.anchored {
+		if len(s.pending) >= maxTCPUnanchoredSegments {
+			return ErrTCPStreamTooLong
+		}
+		s.keep(seq, payload)
+	} else if !s.place(seq, payload) {
+		if len(s.pending) >= maxTCPPendingSegments {
+			return ErrTCPStreamTooLong
+		}
+		s.keep(seq, payload)
+	}
+
+	if len(s.buf)+s.pendingBytes > maxTCPReassemblyBuffer {
+		return ErrTCPStreamTooLong
+	}
+
+	s.drain()
+	return nil
+}
+
+// place appends the part of the segment following the contiguous bytes
+// received so far. It returns false if the segment starts after a gap.
+func (s *tcpStream) place(seq uint32, payload []byte) bool {
+	// Offsets are computed modulo 2^32, so sequence numbers wrapping around
+	// need no special care. Offsets of 2^31 and above are segments starting
+	// before the first byte of the stream.
+	off := seq - s.isn
+	if off >= 1<<31 {
+		skip := s.isn - seq
+		if uint64(skip) >= uint64(len(payload)) {
+			return true // entirely before the stream, e.g., a retransmitted SYN
+		}
+		payload, off = payload[skip:], 0
+	}
+
+	if uint64(off) > uint64(len(s.buf)) {
+		return false
+	}
+	if end := uint64(off) + uint64(len(payload)); end > uint64(len(s.buf)) {
+		s.buf = append(s.buf, payload[uint64(len(s.buf))-uint64(off):]...)
+	}
+	return true
+}
+
+// keep saves an out-of-order segment, keeping the longest one if several
+// share the same sequence number. Once the stream is anchored, the pending
+// segments are kept sorted by offset.
+func (s *tcpStream) keep(seq uint32, payload []byte) {
+	var i int
+	var found bool
+	if s.anchored {
+		i, found = slices.BinarySearchFunc(s.pending, s.offset(seq), func(seg tcpSegment, off int32) int {
+			return int(s.offset(seg.seq)) - int(off)
+		})
+	} else {
+		i = slices.IndexFunc(s.pending, func(seg tcpSegment) bool { return seg.seq == seq })
+		found = i >= 0
+		if !found {
+			i = len(s.pending)
+		}
+	}
+
+	if found {
+		if len(s.pending[i].payload) >= len(payload) {
+			return
+		}
+		s.pendingBytes -= len(s.pending[i].payload)
+		s.pending[i].payload = append([]byte{}, payload...)
+	} else {
+		s.pending = slices.Insert(s.pending, i, tcpSegment{seq: seq, payload: append([]byte{}, payload...)})
+	}
+	s.pendingBytes += len(payload)
+}
+
+// drain places the pending segments which became contiguous. As they are
+// sorted by offset, it stops at the first one starting after a gap.
+func (s *tcpStream) drain() {
+	if !s.anchored {
+		return
+	}
+	for len(s.pending) > 0 && s.place(s.pending[0].seq, s.pending[0].payload) {
+		s.pendingBytes -= len(s.pending[0].payload)
+		s.pending[0] = tcpSegment{} // release the payload
+		s.pending = s.pending[1:]
+	}
+}
+
+// abandon marks the stream as done and releases its buffers.
+func (s *tcpStream) abandon() {
+	s.done = true
+	s.buf, s.pending, s.pendingBytes = nil, nil, 0
+}
@@ -0,0 +1,163 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+type testTCPSegment struct {
+	seq     uint32
+	syn     bool
+	payload []byte
+}
+
+// splitClientHello splits the ClientHello into segments of at most mss
+// bytes starting at isn.
+func splitClientHello(ch []byte, isn uint32, mss int) []testTCPSegment {
+	var segs []testTCPSegment
+	for off := 0; off < len(ch); off += mss {
+		end := off + mss
+		if end > len(ch) {
+			end = len(ch)
+		}
+		segs = append(segs, testTCPSegment{seq: isn + uint32(off), payload: ch[off:end]})
+	}
+	return segs
+}
+
+func TestTCPReassembler(t *testing.T) {
+	want, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const isn = 0x12345678
+	segs := splitClientHello(tlsClientHello_Firefox126, isn, 200) // 4 segments
+	wrapped := splitClientHello(tlsClientHello_Firefox126, 0xffffff00, 200)
+
+	for _, tc := range []struct {
+		name string
+		segs []testTCPSegment
+	}{
+		{"InOrder", segs},
+		{"SYN", append([]testTCPSegment{{seq: isn - 1, syn: true}}, segs...)},
+		{"OutOfOrder", []testTCPSegment{segs[2], segs[0], segs[3], segs[1]}},
+		{"OutOfOrderFirstLast", []testTCPSegment{segs[3], segs[2], segs[1], segs[0]}},
+		{"OutOfOrderSYN", []testTCPSegment{segs[1], {seq: isn - 1, syn: true}, segs[3], segs[2], segs[0]}},
+		{"Retransmitted", []testTCPSegment{segs[0], segs[0], segs[1], segs[0], segs[1], segs[2], segs[3]}},
+		{"Overlapping", []testTCPSegment{
+			{seq: isn, payload: tlsClientHello_Firefox126[:300]},
+			{seq: isn + 100, payload: tlsClientHello_Firefox126[100:500]},
+			{seq: isn + 450, payload: tlsClientHello_Firefox126[450:]},
+		}},
+		{"Wraparound", []testTCPSegment{{seq: 0xffffff00 - 1, syn: true}, wrapped[1], wrapped[0], wrapped[3], wrapped[2]}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewTCPReassembler(0)
+			defer r.Close()
+
+			var got *ClientHello
+			for i, seg := range tc.segs {
+				ch, err := r.AddSegment("192.0.2.1:40000", seg.seq, seg.syn, seg.payload)
+				if i < len(tc.segs)-1 {
+					if !errors.Is(err, ErrNeedMoreSegments) {
+						t.Fatalf("segment %d: got %v, want ErrNeedMoreSegments", i, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("segment %d: %v", i, err)
+				}
+				got = ch
+			}
+
+			if !bytes.Equal(got.Raw(), want.Raw()) {
+				t.Error("reassembled ClientHello does not match")
+			}
+			if got.HexID != want.HexID || got.NormHexID != want.NormHexID {
+				t.Errorf("got IDs %s/%s, want %s/%s", got.HexID, got.NormHexID, want.HexID, want.NormHexID)
+			}
+
+			if _, err := r.AddSegment("192.0.2.1:40000", tc.segs[0].seq, false, tc.segs[0].payload); !errors.Is(err, ErrTCPStreamDone) {
+				t.Errorf("segment after ClientHello: got %v, want ErrTCPStreamDone", err)
+			}
+		})
+	}
+}
+
+func TestTCPReassemblerNotTLS(t *testing.T) {
+	r := NewTCPReassembler(0)
+	defer r.Close()
+
+	if _, err := r.AddSegment("192.0.2.1:40000", 99, true, nil); !errors.Is(err, ErrNeedMoreSegments) {
+		t.Fatalf("SYN: got %v, want ErrNeedMoreSegments", err)
+	}
+	if _, err := r.AddSegment("192.0.2.1:40000", 100, false, []byte("GET / HTTP/1.1\r\n\r\n")); err == nil || errors.Is(err, ErrNeedMoreSegments) {
+		t.Fatalf("plaintext HTTP: got %v, want an error", err)
+	}
+
+	// Without a SYN, a stream not starting with a TLS handshake record is
+	// abandoned after a few segments.
+	var err error
+	for i := uint32(0); i < 16 && !errors.Is(err, ErrTCPStreamTooLong); i++ {
+		_, err = r.AddSegment("192.0.2.1:40001", 1000+i*100, false, bytes.Repeat([]byte{0x17}, 100))
+	}
+	if !errors.Is(err, ErrTCPStreamTooLong) {
+		t.Errorf("got %v, want ErrTCPStreamTooLong", err)
+	}
+}
+
+func TestTCPReassemblerManySegments(t *testing.T) {
+	r := NewTCPReassembler(0)
+	defer r.Close()
+
+	if _, err := r.AddSegment("192.0.2.1:40000", 999, true, nil); !errors.Is(err, ErrNeedMoreSegments) {
+		t.Fatalf("SYN: got %v, want ErrNeedMoreSegments", err)
+	}
+
+	// One-byte segments in reverse order, more than can be buffered.
+	segs := splitClientHello(tlsClientHello_Firefox126, 1000, 1)
+	var err error
+	for i := len(segs) - 1; i > 0 && (err == nil || errors.Is(err, ErrNeedMoreSegments)); i-- {
+		_, err = r.AddSegment("192.0.2.1:40000", segs[i].seq, false, segs[i].payload)
+	}
+	if !errors.Is(err, ErrTCPStreamTooLong) {
+		t.Errorf("got %v, want ErrTCPStreamTooLong", err)
+	}
+}
+
+func TestTCPReassemblerSourcePortReuse(t *testing.T) {
+	r := NewTCPReassembler(time.Hour)
+	defer r.Close()
+
+	for i, isn := range []uint32{1000, 5000} {
+		if _, err := r.AddSegment("192.0.2.1:40000", isn-1, true, nil); !errors.Is(err, ErrNeedMoreSegments) {
+			t.Fatalf("connection %d: SYN: got %v, want ErrNeedMoreSegments", i, err)
+		}
+		if _, err := r.AddSegment("192.0.2.1:40000", isn, false, tlsClientHello_Firefox126); err != nil {
+			t.Fatalf("connection %d: %v", i, err)
+		}
+	}
+}
+
+func TestTLSFingerprinterReassemblerTimeout(t *testing.T) {
+	tfp := NewTLSFingerprinterWithTimeout(50 * time.Millisecond)
+	defer tfp.Close()
+
+	// An incomplete ClientHello is forgotten along with its fingerprint, so
+	// the rest of it alone is not enough.
+	if err := tfp.HandleTCPSegment("192.0.2.1:40000", 1000, false, tlsClientHello_Firefox126[:100]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := tfp.HandleTCPSegment("192.0.2.1:40000", 1100, false, tlsClientHello_Firefox126[100:]); err != nil {
+		t.Fatal(err)
+	}
+	if tfp.Peek("192.0.2.1:40000") != nil {
+		t.Error("TCP stream should have expired with the fingerprinter timeout")
+	}
+}
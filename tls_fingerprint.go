@@ -3,6 +3,7 @@ package clienthellod
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -15,7 +16,9 @@ const DEFAULT_TLSFINGERPRINT_EXPIRY = 5 * time.Second
 
 // TLSFingerprinter can be used to fingerprint TLS connections.
 type TLSFingerprinter struct {
-	mapClientHellos *sync.Map
+	mapClientHellos FingerprintStore
+	janitor         *utils.Janitor
+	reassembler     *TCPReassembler
 
 	timeout time.Duration
 	closed  atomic.Bool
@@ -23,24 +26,35 @@ type TLSFingerprinter struct {
 
 // NewTLSFingerprinter creates a new TLSFingerprinter.
 func NewTLSFingerprinter() *TLSFingerprinter {
-	return &TLSFingerprinter{
-		mapClientHellos: new(sync.Map),
-		closed:          atomic.Bool{},
-	}
+	return NewTLSFingerprinterWithStore(new(sync.Map))
 }
 
 // NewTLSFingerprinterWithTimeout creates a new TLSFingerprinter with a timeout.
 func NewTLSFingerprinterWithTimeout(timeout time.Duration) *TLSFingerprinter {
+	tfp := NewTLSFingerprinterWithStore(new(sync.Map))
+	tfp.SetTimeout(timeout)
+	return tfp
+}
+
+// NewTLSFingerprinterWithStore creates a new TLSFingerprinter saving
+// ClientHellos to the given store, e.g., a bounded [LRUStore].
+func NewTLSFingerprinterWithStore(store FingerprintStore) *TLSFingerprinter {
 	return &TLSFingerprinter{
-		mapClientHellos: new(sync.Map),
-		timeout:         timeout,
+		mapClientHellos: store,
+		janitor:         newStoreJanitor(store),
+		reassembler:     NewTCPReassembler(DEFAULT_TLSFINGERPRINT_EXPIRY),
 		closed:          atomic.Bool{},
 	}
 }
 
-// SetTimeout sets the timeout for the TLSFingerprinter.
+// SetTimeout sets the timeout for the TLSFingerprinter. It also bounds how
+// long the TCP streams handled by HandleTCPSegment are tracked.
 func (tfp *TLSFingerprinter) SetTimeout(timeout time.Duration) {
 	tfp.timeout = timeout
+	if timeout == time.Duration(0) {
+		timeout = DEFAULT_TLSFINGERPRINT_EXPIRY
+	}
+	tfp.reassembler.SetTimeout(timeout)
 }
 
 // HandleMessage handles a message.
@@ -54,16 +68,7 @@ func (tfp *TLSFingerprinter) HandleMessage(from string, p []byte) error {
 		return err
 	}
 
-	tfp.mapClientHellos.Store(from, ch)
-	go func(timeoutOverride time.Duration, key string, oldCh *ClientHello) {
-		if timeoutOverride == time.Duration(0) {
-			<-time.After(DEFAULT_TLSFINGERPRINT_EXPIRY)
-		} else {
-			<-time.After(timeoutOverride)
-		}
-		// tfp.mapClientHellos.Delete(key)
-		tfp.mapClientHellos.CompareAndDelete(key, oldCh)
-	}(tfp.timeout, from, ch)
+	tfp.store(from, ch)
 
 	return nil
 }
@@ -83,20 +88,73 @@ func (tfp *TLSFingerprinter) HandleTCPConn(conn net.Conn) (rewindConn net.Conn,
 		return nil, fmt.Errorf("failed to parse ClientHello: %w", err)
 	}
 
-	tfp.mapClientHellos.Store(conn.RemoteAddr().String(), ch)
-	go func(timeoutOverride time.Duration, key string, oldCh *ClientHello) {
-		if timeoutOverride == time.Duration(0) {
-			<-time.After(DEFAULT_TLSFINGERPRINT_EXPIRY)
-		} else {
-			<-time.After(timeoutOverride)
-		}
-		// tfp.mapClientHellos.Delete(key)
-		tfp.mapClientHellos.CompareAndDelete(key, oldCh)
-	}(tfp.timeout, conn.RemoteAddr().String(), ch)
+	tfp.store(conn.RemoteAddr().String(), ch)
 
 	return utils.RewindConn(conn, ch.Raw())
 }
 
+// HandleTCPSegment handles a TCP segment sent by a client, e.g., read from
+// a raw socket. The ClientHello is saved once all segments carrying it are
+// received, in whatever order.
+func (tfp *TLSFingerprinter) HandleTCPSegment(from string, seq uint32, syn bool, payload []byte) error {
+	if tfp.closed.Load() {
+		return errors.New("TLSFingerprinter closed")
+	}
+
+	ch, err := tfp.reassembler.AddSegment(from, seq, syn, payload)
+	if err != nil {
+		if errors.Is(err, ErrNeedMoreSegments) || errors.Is(err, ErrTCPStreamDone) {
+			return nil // totally fine, the ClientHello is incomplete or already saved
+		}
+		return err
+	}
+
+	tfp.store(from, ch)
+
+	return nil
+}
+
+// HandleIPConn handles TCP segments read from a raw IP socket.
+func (tfp *TLSFingerprinter) HandleIPConn(ipc *net.IPConn) error {
+	var buf [65535]byte
+	for {
+		if tfp.closed.Load() {
+			return errors.New("TLSFingerprinter closed")
+		}
+
+		n, ipAddr, err := ipc.ReadFromIP(buf[:])
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			continue // ignore errors unless connection is closed
+		}
+
+		tcpSeg, err := utils.ParseTCPSegment(buf[:n])
+		if err != nil {
+			continue
+		}
+		if tcpSeg.DstPort != 443 {
+			continue
+		}
+		tcpAddr := &net.TCPAddr{IP: ipAddr.IP, Port: int(tcpSeg.SrcPort)}
+
+		tfp.HandleTCPSegment(tcpAddr.String(), tcpSeg.Seq, tcpSeg.SYN, tcpSeg.Payload)
+	}
+}
+
+// store saves the ClientHello and schedules its expiry.
+func (tfp *TLSFingerprinter) store(from string, ch *ClientHello) {
+	ch.expiryToken = lastExpiryToken.Add(1)
+	tfp.mapClientHellos.Store(from, ch)
+
+	if tfp.timeout == time.Duration(0) {
+		tfp.janitor.Schedule(DEFAULT_TLSFINGERPRINT_EXPIRY, storeExpiry{from, ch.expiryToken}, nil)
+	} else {
+		tfp.janitor.Schedule(tfp.timeout, storeExpiry{from, ch.expiryToken}, nil)
+	}
+}
+
 // Peek looks up a ClientHello for a given key.
 func (tfp *TLSFingerprinter) Peek(from string) *ClientHello {
 	ch, ok := tfp.mapClientHellos.Load(from)
@@ -119,6 +177,7 @@ func (tfp *TLSFingerprinter) Pop(from string) *ClientHello {
 	if !ok {
 		return nil
 	}
+	tfp.janitor.Cancel(storeExpiry{from, expiryToken(ch)})
 
 	clientHello, ok := ch.(*ClientHello)
 	if !ok {
@@ -128,7 +187,10 @@ func (tfp *TLSFingerprinter) Pop(from string) *ClientHello {
 	return clientHello
 }
 
-// Close closes the TLSFingerprinter.
+// Close closes the TLSFingerprinter and stops expiring the saved
+// ClientHellos.
 func (tfp *TLSFingerprinter) Close() {
 	tfp.closed.Store(true)
+	tfp.janitor.Close()
+	tfp.reassembler.Close()
 }
@@ -0,0 +1,115 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/refraction-networking/clienthellod"
+)
+
+func TestTLSFingerprinterExpiry(t *testing.T) {
+	tfp := NewTLSFingerprinterWithTimeout(50 * time.Millisecond)
+	defer tfp.Close()
+
+	if err := tfp.HandleMessage("10.0.0.1:1234", tlsClientHello_Firefox126); err != nil {
+		t.Fatal(err)
+	}
+	if tfp.Peek("10.0.0.1:1234") == nil {
+		t.Fatal("ClientHello not found")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if tfp.Peek("10.0.0.1:1234") != nil {
+		t.Fatal("ClientHello should have expired")
+	}
+}
+
+func BenchmarkTLSFingerprinterHandleMessage(b *testing.B) {
+	tfp := NewTLSFingerprinterWithTimeout(time.Minute)
+	defer tfp.Close()
+
+	goroutines := runtime.NumGoroutine()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tfp.HandleMessage(fmt.Sprintf("10.0.%d.%d:443", (i>>8)&0xff, i&0xff), tlsClientHello_Firefox126); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(runtime.NumGoroutine()-goroutines), "goroutines")
+}
+
+func TestTLSFingerprinterHandleTCPSegment(t *testing.T) {
+	tfp := NewTLSFingerprinter()
+	defer tfp.Close()
+
+	segs := splitClientHello(tlsClientHello_Firefox126, 1000, 300)
+	for i := len(segs) - 1; i >= 0; i-- {
+		if tfp.Peek("10.0.0.1:1234") != nil {
+			t.Fatal("ClientHello saved before all segments are received")
+		}
+		if err := tfp.HandleTCPSegment("10.0.0.1:1234", segs[i].seq, false, segs[i].payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch := tfp.Peek("10.0.0.1:1234")
+	if ch == nil {
+		t.Fatal("ClientHello not found")
+	}
+	if !bytes.Equal(ch.Raw(), tlsClientHello_Firefox126) {
+		t.Error("reassembled ClientHello does not match")
+	}
+
+	// a retransmission must not fail nor replace the saved ClientHello
+	if err := tfp.HandleTCPSegment("10.0.0.1:1234", segs[0].seq, false, segs[0].payload); err != nil {
+		t.Fatal(err)
+	}
+	if tfp.Peek("10.0.0.1:1234") != ch {
+		t.Error("ClientHello replaced by a retransmission")
+	}
+}
+
+func TestTLSFingerprinterHandleTCPConnFragmented(t *testing.T) {
+	tfp := NewTLSFingerprinter()
+	defer tfp.Close()
+
+	wire := fragmentClientHello(tlsClientHello_Firefox126, 100, 200)
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		_, _ = client.Write(append(append([]byte{}, wire...), "after"...))
+	}()
+
+	rewindConn, err := tfp.HandleTCPConn(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rewindConn.Close()
+
+	ch := tfp.Peek(client.LocalAddr().String())
+	if ch == nil {
+		t.Fatal("ClientHello not found")
+	}
+	if len(ch.TLSRecordLengths) != 3 {
+		t.Errorf("TLSRecordLengths = %v, want 3 records", ch.TLSRecordLengths)
+	}
+
+	// every consumed record is rewound, followed by the rest of the stream
+	got := make([]byte, len(wire)+len("after"))
+	if _, err = io.ReadFull(rewindConn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[:len(wire)], wire) || string(got[len(wire):]) != "after" {
+		t.Error("rewound bytes do not match the bytes on the wire")
+	}
+}